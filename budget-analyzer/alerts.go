@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+const alertSettingsNamespace = "alert-settings"
+
+// Alert kinds
+const (
+	alertBudgetThreshold  = "budget_threshold"
+	alertSubcategoryOver  = "subcategory_over_budget"
+	alertOverallThreshold = "overall_threshold"
+
+	alertEnvelopeOverdrawn    = "envelope_overdrawn"
+	alertEnvelopeOverassigned = "envelope_overassigned" // envelopes hold more than the income
+	alertEnvelopeUnassigned   = "envelope_unassigned"   // income not given a job
+)
+
+// Alert levels
+const (
+	alertLevelWarning  = "warning"
+	alertLevelCritical = "critical"
+)
+
+// Highest accepted threshold, in % of budget used
+const maxAlertThresholdValue = 1000.0
+
+// AlertSettings are a user's default thresholds, in % of budget used. A
+// budget's own thresholds take precedence over these.
+type AlertSettings struct {
+	WarningThreshold         float64 `json:"warning_threshold"`
+	CriticalThreshold        float64 `json:"critical_threshold"`
+	OverallWarningThreshold  float64 `json:"overall_warning_threshold"`
+	OverallCriticalThreshold float64 `json:"overall_critical_threshold"`
+}
+
+func defaultAlertSettings() AlertSettings {
+	return AlertSettings{
+		WarningThreshold:         80,
+		CriticalThreshold:        90, // below 100, where a budget is over_budget rather than critical
+		OverallWarningThreshold:  75,
+		OverallCriticalThreshold: 90,
+	}
+}
+
+// Alert is one threshold crossed in an analysis. ID fingerprints the alert
+// (kind, category, level and period), so the same condition in the same
+// period always has the same ID.
+type Alert struct {
+	ID               string        `json:"id"`
+	Kind             string        `json:"kind"` // budget_threshold, pace, subcategory_over_budget, overall_threshold, rule, envelope_*
+	Category         string        `json:"category,omitempty"`
+	Level            string        `json:"level"`     // warning, critical
+	Threshold        float64       `json:"threshold"` // % of budget crossed, or a rule's threshold
+	PercentageUsed   float64       `json:"percentage_used"`
+	Amount           float64       `json:"amount"` // spent, or spent on a rule's matching transactions
+	Budgeted         float64       `json:"budgeted"`
+	PeriodStart      string        `json:"period_start"`
+	ProjectedOverrun float64       `json:"projected_overrun,omitempty"` // pace alerts only
+	ExhaustionDate   string        `json:"exhaustion_date,omitempty"`   // pace alerts only
+	RuleID           int           `json:"rule_id,omitempty"`           // rule alerts only
+	Rule             string        `json:"rule,omitempty"`
+	Transactions     []Transaction `json:"transactions,omitempty"` // the transactions that triggered a rule
+	Message          string        `json:"message"`
+	Status           string        `json:"status,omitempty"` // new, acknowledged, snoozed; from the alert store
+	FirstFiredAt     *time.Time    `json:"first_fired_at,omitempty"`
+	Timestamp        time.Time     `json:"timestamp"`
+}
+
+func newAlert(kind, category, level string, periodStart string, now time.Time) Alert {
+	sum := sha256.Sum256([]byte(kind + "|" + category + "|" + level + "|" + periodStart))
+	return Alert{
+		ID:          hex.EncodeToString(sum[:8]),
+		Kind:        kind,
+		Category:    category,
+		Level:       level,
+		PeriodStart: periodStart,
+		Timestamp:   now.UTC(),
+	}
+}
+
+// Warning and critical thresholds for a budget, falling back to the settings
+func budgetThresholds(budget Budget, settings AlertSettings) (warning float64, critical float64) {
+	warning, critical = settings.WarningThreshold, settings.CriticalThreshold
+	if budget.WarningThreshold > 0 {
+		warning = budget.WarningThreshold
+	}
+	if budget.CriticalThreshold > 0 {
+		critical = budget.CriticalThreshold
+	}
+	return warning, critical
+}
+
+// Checks a warning/critical pair; zero means "not set" when optional
+func validateThresholdPair(warningField string, warning float64, criticalField string, critical float64, optional bool) []FieldError {
+	var details []FieldError
+	for _, threshold := range []struct {
+		field string
+		value float64
+	}{{warningField, warning}, {criticalField, critical}} {
+		if optional && threshold.value == 0 {
+			continue
+		}
+		if threshold.value <= 0 || threshold.value > maxAlertThresholdValue {
+			details = append(details, FieldError{Field: threshold.field, Message: fmt.Sprintf("must be greater than 0 and at most %g", maxAlertThresholdValue)})
+		}
+	}
+	if len(details) == 0 && warning > 0 && critical > 0 && warning >= critical {
+		details = append(details, FieldError{Field: warningField, Message: "must be below " + criticalField})
+	}
+	return details
+}
+
+func loadAlertSettings(userID string) (AlertSettings, error) {
+	settings := defaultAlertSettings()
+	if _, err := documents.Load(alertSettingsNamespace, userID, &settings); err != nil {
+		return settings, wrapAPIError(CodeInternal, "Alert settings storage is unavailable", err)
+	}
+	return settings, nil
+}
+
+// The authenticated user's default alert thresholds:
+//
+//	GET    ?action=alert-settings    current settings
+//	PUT    ?action=alert-settings    replace, omitted fields keep their defaults
+//	DELETE ?action=alert-settings    reset to defaults
+func handleAlertSettings(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, _, err := requireAuth(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	settings := defaultAlertSettings()
+	switch r.Method {
+	case "GET":
+		if settings, err = loadAlertSettings(userID); err != nil {
+			writeError(w, requestID, err)
+			return
+		}
+	case "PUT":
+		hasBody, decodeErr := decodeJSONBody(w, r, &settings)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+
+		details := validateThresholdPair("warning_threshold", settings.WarningThreshold, "critical_threshold", settings.CriticalThreshold, false)
+		details = append(details, validateThresholdPair("overall_warning_threshold", settings.OverallWarningThreshold, "overall_critical_threshold", settings.OverallCriticalThreshold, false)...)
+		if len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+
+		if err := documents.Save(alertSettingsNamespace, userID, settings); err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Alert settings storage is unavailable", err))
+			return
+		}
+		userAnalyses.invalidate(userID)
+	case "DELETE":
+		if err := documents.Delete(alertSettingsNamespace, userID); err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Alert settings storage is unavailable", err))
+			return
+		}
+		userAnalyses.invalidate(userID)
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"data":        settings,
+		"computed_at": time.Now().Unix(),
+		"function":    "budget-analyzer",
+		"runtime":     "Go",
+	})
+}
+
+// The alert for a budget that has crossed its warning or critical threshold
+func budgetThresholdAlert(analysis BudgetAnalysis, warningAt, criticalAt float64, now time.Time) (Alert, bool) {
+	level, threshold := alertLevelCritical, criticalAt
+	if analysis.PercentageUsed < criticalAt {
+		level, threshold = alertLevelWarning, warningAt
+	}
+	if analysis.PercentageUsed < threshold {
+		return Alert{}, false
+	}
+
+	alert := newAlert(alertBudgetThreshold, analysis.Category, level, analysis.PeriodStart, now)
+	alert.Threshold = threshold
+	alert.PercentageUsed = analysis.PercentageUsed
+	alert.Amount = math.Round(analysis.Spent*100) / 100
+	alert.Budgeted = analysis.Budgeted
+	switch {
+	case analysis.PercentageUsed >= 100:
+		alert.Message = analysis.Category + " is over budget"
+	case level == alertLevelCritical:
+		alert.Message = fmt.Sprintf("%s has used %.0f%% of its budget", analysis.Category, analysis.PercentageUsed)
+	default:
+		alert.Message = analysis.Category + " is approaching budget limit"
+	}
+	return alert, true
+}
+
+// The alert for overall spending past the user's overall thresholds
+func overallThresholdAlert(status string, percentageUsed, budgeted, spent float64, window budgetWindow, opts analysisOptions) Alert {
+	level, threshold := alertLevelWarning, opts.Alerts.OverallWarningThreshold
+	if status == "critical" {
+		level, threshold = alertLevelCritical, opts.Alerts.OverallCriticalThreshold
+	}
+
+	alert := newAlert(alertOverallThreshold, "", level, window.Start.Format("2006-01-02"), opts.Now)
+	alert.Threshold = threshold
+	alert.PercentageUsed = math.Round(percentageUsed*100) / 100
+	alert.Amount = math.Round(spent*100) / 100
+	alert.Budgeted = math.Round(budgeted*100) / 100
+	alert.Message = fmt.Sprintf("Overall spending is at %.0f%% of your budgets", percentageUsed)
+	return alert
+}
+
+// Applies the user's default thresholds and custom rules to analysis options
+func withUserAlertSettings(opts analysisOptions, userID string) (analysisOptions, error) {
+	settings, err := loadAlertSettings(userID)
+	if err != nil {
+		return opts, err
+	}
+	rules, err := loadAlertRules(userID)
+	if err != nil {
+		return opts, err
+	}
+	opts.Alerts = settings
+	opts.Rules = rules.Rules
+	return opts, nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The alert store remembers every alert a user's analyses have raised: when
+// it first fired, when it stopped firing, and whether the user acknowledged
+// or snoozed it. Analyses only show new (unacknowledged, unsnoozed) alerts
+// unless asked for all of them.
+const alertStatesNamespace = "alert-states"
+
+const (
+	maxTrackedAlerts    = 500
+	resolvedAlertTTL    = 90 * 24 * time.Hour // resolved alerts are forgotten after this
+	defaultSnoozeHours  = 24
+	maxSnoozeHours      = 30 * 24
+	alertStatusNew      = "new"
+	alertStatusAcked    = "acknowledged"
+	alertStatusSnoozed  = "snoozed"
+	alertStatusResolved = "resolved"
+)
+
+var validAlertOps = map[string]bool{"ack": true, "snooze": true, "reset": true}
+
+// Serializes read-modify-write cycles on alert states
+var alertStatesMu sync.Mutex
+
+// AlertState is the lifecycle of one alert ID
+type AlertState struct {
+	ID             string     `json:"id"`
+	Kind           string     `json:"kind"`
+	Category       string     `json:"category,omitempty"`
+	Level          string     `json:"level"`
+	Message        string     `json:"message"`
+	PeriodStart    string     `json:"period_start"`
+	Variant        string     `json:"variant,omitempty"` // the analysis view it last fired in; only that view resolves it
+	Status         string     `json:"status"`            // new, acknowledged, snoozed, resolved
+	FirstFiredAt   time.Time  `json:"first_fired_at"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	SnoozedUntil   *time.Time `json:"snoozed_until,omitempty"`
+}
+
+// Stored form of one user's alert states. Revision changes whenever the user
+// acknowledges or snoozes, so cached analyses can tell.
+type userAlertStates struct {
+	Revision int                    `json:"revision"`
+	Alerts   map[string]*AlertState `json:"alerts"`
+}
+
+// Body of an alert change:
+//
+//	{"op": "ack", "id": "..."}
+//	{"op": "snooze", "id": "...", "hours": 48}
+//	{"op": "reset", "id": "..."}    clear acknowledgement and snooze
+type alertOpRequest struct {
+	Op    string `json:"op"`
+	ID    string `json:"id"`
+	Hours int    `json:"hours"`
+}
+
+func (s *AlertState) status(now time.Time) string {
+	switch {
+	case s.ResolvedAt != nil:
+		return alertStatusResolved
+	case s.SnoozedUntil != nil && s.SnoozedUntil.After(now):
+		return alertStatusSnoozed
+	case s.AcknowledgedAt != nil:
+		return alertStatusAcked
+	}
+	return alertStatusNew
+}
+
+// Identifies the state an analysis response depends on, for ETags: the
+// user's last change and which snoozes are still running
+func (d userAlertStates) variant(now time.Time) string {
+	var snoozed []string
+	for id, state := range d.Alerts {
+		if state.SnoozedUntil != nil && state.SnoozedUntil.After(now) {
+			snoozed = append(snoozed, id)
+		}
+	}
+	sort.Strings(snoozed)
+	return fmt.Sprintf("s%d:%s", d.Revision, strings.Join(snoozed, ","))
+}
+
+func loadAlertStates(userID string) (userAlertStates, error) {
+	doc := userAlertStates{}
+	if _, err := documents.Load(alertStatesNamespace, userID, &doc); err != nil {
+		return doc, wrapAPIError(CodeInternal, "Alert storage is unavailable", err)
+	}
+	if doc.Alerts == nil {
+		doc.Alerts = make(map[string]*AlertState)
+	}
+	return doc, nil
+}
+
+func saveAlertStates(userID string, doc userAlertStates) error {
+	if err := documents.Save(alertStatesNamespace, userID, doc); err != nil {
+		return wrapAPIError(CodeInternal, "Alert storage is unavailable", err)
+	}
+	return nil
+}
+
+// Identifies the analysis view whose alerts are tracked: analyses with a
+// different week start or different generated budgets raise different
+// alerts, and one mustn't resolve the other's
+func alertTrackingVariant(opts analysisOptions, budgetSource string, genOpts generationOptions) string {
+	variant := opts.WeekStart.String() + "|" + budgetSource
+	if budgetSource == "generated" {
+		variant += "|" + genOpts.variant()
+	}
+	return variant
+}
+
+// Records the alerts of a current-period analysis: alerts seen for the first
+// time start as new, and tracked alerts of the same view that no longer fire
+// are resolved. An alert that fires again reopens with its acknowledgement
+// intact, as its ID ties it to the same period.
+func trackAlerts(userID string, alerts []Alert, variant string, now time.Time) (userAlertStates, error) {
+	alertStatesMu.Lock()
+	defer alertStatesMu.Unlock()
+
+	doc, err := loadAlertStates(userID)
+	if err != nil {
+		return doc, err
+	}
+
+	changed := false
+	firing := make(map[string]bool, len(alerts))
+	for _, alert := range alerts {
+		firing[alert.ID] = true
+		state, ok := doc.Alerts[alert.ID]
+		if !ok {
+			doc.Alerts[alert.ID] = &AlertState{
+				ID:           alert.ID,
+				Kind:         alert.Kind,
+				Category:     alert.Category,
+				Level:        alert.Level,
+				Message:      alert.Message,
+				PeriodStart:  alert.PeriodStart,
+				Variant:      variant,
+				FirstFiredAt: now.UTC(),
+			}
+			changed = true
+			continue
+		}
+		if state.ResolvedAt != nil {
+			state.ResolvedAt = nil
+			changed = true
+		}
+		if state.Variant != variant {
+			state.Variant = variant
+			changed = true
+		}
+		if state.Message != alert.Message {
+			state.Message = alert.Message
+			changed = true
+		}
+	}
+
+	for id, state := range doc.Alerts {
+		if state.ResolvedAt == nil && !firing[id] && state.Variant == variant {
+			resolvedAt := now.UTC()
+			state.ResolvedAt = &resolvedAt
+			changed = true
+		}
+		if state.ResolvedAt != nil && now.Sub(*state.ResolvedAt) > resolvedAlertTTL {
+			delete(doc.Alerts, id)
+			changed = true
+		}
+	}
+	if len(doc.Alerts) > maxTrackedAlerts {
+		pruneAlertStates(&doc)
+		changed = true
+	}
+
+	if changed {
+		if err := saveAlertStates(userID, doc); err != nil {
+			return doc, err
+		}
+	}
+	return doc, nil
+}
+
+// Drops the longest-resolved alerts until the store is within its limit
+func pruneAlertStates(doc *userAlertStates) {
+	var resolved []*AlertState
+	for _, state := range doc.Alerts {
+		if state.ResolvedAt != nil {
+			resolved = append(resolved, state)
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].ResolvedAt.Before(*resolved[j].ResolvedAt) })
+	for _, state := range resolved {
+		if len(doc.Alerts) <= maxTrackedAlerts {
+			break
+		}
+		delete(doc.Alerts, state.ID)
+	}
+}
+
+// The alerts to show: each annotated with its state, keeping acknowledged
+// and snoozed ones only when all is set
+func visibleAlerts(alerts []Alert, doc userAlertStates, now time.Time, all bool) []Alert {
+	visible := make([]Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		alert.Status = alertStatusNew
+		if state, ok := doc.Alerts[alert.ID]; ok {
+			firstFiredAt := state.FirstFiredAt
+			alert.FirstFiredAt = &firstFiredAt
+			if status := state.status(now); status != alertStatusResolved {
+				alert.Status = status
+			}
+		}
+		if all || alert.Status == alertStatusNew {
+			visible = append(visible, alert)
+		}
+	}
+	return visible
+}
+
+// Which alerts an analysis shows, from ?alerts=new (default) or all
+func alertVisibilityFromQuery(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("alerts") {
+	case "", alertStatusNew:
+		return false, nil
+	case "all":
+		return true, nil
+	}
+	return false, validationError([]FieldError{{Field: "alerts", Message: "must be one of new, all"}})
+}
+
+// The authenticated user's tracked alerts:
+//
+//	GET  ?action=alerts                  all tracked alerts, newest first
+//	GET  ?action=alerts&status=new       only those with this status
+//	POST ?action=alerts                  {"op": "ack"|"snooze"|"reset", "id": "..."}
+func handleAlerts(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, _, err := requireAuth(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	now := time.Now()
+
+	var result interface{}
+	switch r.Method {
+	case "GET":
+		filter := r.URL.Query().Get("status")
+		switch filter {
+		case "", alertStatusNew, alertStatusAcked, alertStatusSnoozed, alertStatusResolved:
+		default:
+			writeError(w, requestID, validationError([]FieldError{{Field: "status", Message: "must be one of new, acknowledged, snoozed, resolved"}}))
+			return
+		}
+
+		doc, loadErr := loadAlertStates(userID)
+		if loadErr != nil {
+			writeError(w, requestID, loadErr)
+			return
+		}
+		states := make([]AlertState, 0, len(doc.Alerts))
+		for _, stored := range doc.Alerts {
+			state := *stored
+			state.Status = state.status(now)
+			if filter == "" || state.Status == filter {
+				states = append(states, state)
+			}
+		}
+		sort.Slice(states, func(i, j int) bool {
+			if !states[i].FirstFiredAt.Equal(states[j].FirstFiredAt) {
+				return states[i].FirstFiredAt.After(states[j].FirstFiredAt)
+			}
+			return states[i].ID < states[j].ID
+		})
+		result = states
+
+	case "POST":
+		var request alertOpRequest
+		hasBody, decodeErr := decodeJSONBody(w, r, &request)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+
+		var details []FieldError
+		if !validAlertOps[request.Op] {
+			details = append(details, FieldError{Field: "op", Message: "must be one of ack, snooze, reset"})
+		}
+		if strings.TrimSpace(request.ID) == "" {
+			details = append(details, FieldError{Field: "id", Message: "is required"})
+		}
+		if request.Op == "snooze" {
+			if request.Hours == 0 {
+				request.Hours = defaultSnoozeHours
+			}
+			if request.Hours < 0 || request.Hours > maxSnoozeHours {
+				details = append(details, FieldError{Field: "hours", Message: fmt.Sprintf("must be between 1 and %d", maxSnoozeHours)})
+			}
+		} else if request.Hours != 0 {
+			details = append(details, FieldError{Field: "hours", Message: "is only allowed with op=snooze"})
+		}
+		if len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+
+		alertStatesMu.Lock()
+		doc, loadErr := loadAlertStates(userID)
+		if loadErr != nil {
+			alertStatesMu.Unlock()
+			writeError(w, requestID, loadErr)
+			return
+		}
+		state, ok := doc.Alerts[request.ID]
+		if !ok {
+			alertStatesMu.Unlock()
+			writeError(w, requestID, newAPIError(CodeNotFound, "Alert not found"))
+			return
+		}
+
+		at := now.UTC()
+		switch request.Op {
+		case "ack":
+			state.AcknowledgedAt = &at
+		case "snooze":
+			until := at.Add(time.Duration(request.Hours) * time.Hour)
+			state.SnoozedUntil = &until
+		case "reset":
+			state.AcknowledgedAt = nil
+			state.SnoozedUntil = nil
+		}
+		doc.Revision++
+		saveErr := saveAlertStates(userID, doc)
+		alertStatesMu.Unlock()
+		if saveErr != nil {
+			writeError(w, requestID, saveErr)
+			return
+		}
+
+		updated := *state
+		updated.Status = updated.status(now)
+		result = updated
+
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"data":        result,
+		"computed_at": now.Unix(),
+		"function":    "budget-analyzer",
+		"runtime":     "Go",
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrackAlerts(t *testing.T) {
+	userID := "alert-state-user"
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	rent := Alert{ID: "rent", Kind: alertBudgetThreshold, Category: "Rent", Level: alertLevelWarning, Message: "Rent is approaching budget limit"}
+	dining := Alert{ID: "dining", Kind: alertBudgetThreshold, Category: "Dining", Level: alertLevelCritical, Message: "Dining has used 95% of its budget"}
+
+	status := func(doc userAlertStates, id string, at time.Time) string {
+		if state, ok := doc.Alerts[id]; ok {
+			return state.status(at)
+		}
+		return "untracked"
+	}
+
+	doc, err := trackAlerts(userID, []Alert{rent, dining}, "monday|stored", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status(doc, "rent", now) != alertStatusNew || status(doc, "dining", now) != alertStatusNew {
+		t.Fatalf("first round: rent %s, dining %s; want both new", status(doc, "rent", now), status(doc, "dining", now))
+	}
+
+	// The user acknowledges rent
+	acked := now.Add(time.Hour)
+	doc.Alerts["rent"].AcknowledgedAt = &acked
+	doc.Revision++
+	if err := saveAlertStates(userID, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another view's analysis neither resolves nor re-tags these
+	later := now.Add(2 * time.Hour)
+	if doc, _ = trackAlerts(userID, nil, "sunday|stored", later); status(doc, "rent", later) != alertStatusAcked || status(doc, "dining", later) != alertStatusNew {
+		t.Errorf("other view: rent %s, dining %s; want acknowledged, new", status(doc, "rent", later), status(doc, "dining", later))
+	}
+
+	// The same view without rent resolves it...
+	if doc, _ = trackAlerts(userID, []Alert{dining}, "monday|stored", later); status(doc, "rent", later) != alertStatusResolved {
+		t.Errorf("rent is %s once it stops firing, want resolved", status(doc, "rent", later))
+	}
+
+	// ...and when it fires again it reopens still acknowledged, with its
+	// first firing time and the new message
+	rent.Message = "Rent has used 85% of its budget"
+	doc, _ = trackAlerts(userID, []Alert{rent, dining}, "monday|stored", later.Add(time.Hour))
+	state := doc.Alerts["rent"]
+	if state.status(later) != alertStatusAcked || !state.FirstFiredAt.Equal(now) || state.Message != rent.Message {
+		t.Errorf("refired rent = %+v, want acknowledged, first fired %s, new message", *state, now)
+	}
+
+	// Resolved alerts are forgotten after the TTL
+	trackAlerts(userID, nil, "monday|stored", later)
+	forgotten := later.Add(resolvedAlertTTL + time.Hour)
+	if doc, _ = trackAlerts(userID, nil, "monday|stored", forgotten); len(doc.Alerts) != 0 {
+		t.Errorf("%d alerts still tracked after the TTL, want 0", len(doc.Alerts))
+	}
+}
+
+func TestVisibleAlerts(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	doc := userAlertStates{Alerts: map[string]*AlertState{
+		"acked":          {ID: "acked", AcknowledgedAt: &past, FirstFiredAt: past},
+		"snoozed":        {ID: "snoozed", SnoozedUntil: &future, FirstFiredAt: past},
+		"snooze-expired": {ID: "snooze-expired", SnoozedUntil: &past, FirstFiredAt: past},
+		"resolved":       {ID: "resolved", ResolvedAt: &past, FirstFiredAt: past},
+	}}
+	alerts := []Alert{{ID: "acked"}, {ID: "snoozed"}, {ID: "snooze-expired"}, {ID: "resolved"}, {ID: "untracked"}}
+
+	statuses := func(visible []Alert) string {
+		var parts []string
+		for _, alert := range visible {
+			parts = append(parts, alert.ID+"="+alert.Status)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	if got, want := statuses(visibleAlerts(alerts, doc, now, false)), "snooze-expired=new resolved=new untracked=new"; got != want {
+		t.Errorf("new alerts = %s, want %s", got, want)
+	}
+	if got, want := statuses(visibleAlerts(alerts, doc, now, true)), "acked=acknowledged snoozed=snoozed snooze-expired=new resolved=new untracked=new"; got != want {
+		t.Errorf("all alerts = %s, want %s", got, want)
+	}
+}
+
+func TestAlertStatesVariant(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	until := now.Add(time.Hour)
+	doc := userAlertStates{Revision: 3, Alerts: map[string]*AlertState{"a": {ID: "a", SnoozedUntil: &until}}}
+
+	snoozing := doc.variant(now)
+	if doc.variant(until.Add(time.Second)) == snoozing {
+		t.Error("variant doesn't change when a snooze runs out")
+	}
+	doc.Revision++
+	if doc.variant(now) == snoozing {
+		t.Error("variant doesn't change with the revision")
+	}
+}
+
+func TestAcknowledgedAlertLeavesAnalysis(t *testing.T) {
+	userID := "alert-ack-user"
+	newTestServices(t, userID, []Transaction{
+		{ID: "t1", Category: "Dining", Amount: 350, Date: time.Now().Format("2006-01-02"), Type: "expense"},
+	})
+	if _, err := budgetStore.Create(userID, Budget{Category: "Dining", Amount: 300, Period: "monthly"}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, body := serveTestRequest(t, "GET", "/", nil)
+	alerts, _ := body["data"].(map[string]interface{})["alerts"].([]interface{})
+	var id string
+	for _, alert := range alerts {
+		if alert := alert.(map[string]interface{}); alert["category"] == "Dining" && alert["kind"] == alertBudgetThreshold {
+			id = alert["id"].(string)
+		}
+	}
+	if id == "" {
+		t.Fatalf("no Dining alert in %v", alerts)
+	}
+
+	r := httptest.NewRequest("POST", "/?action=alerts", strings.NewReader(`{"op":"ack","id":"`+id+`"}`))
+	r.Header.Set("Authorization", "Bearer token-"+t.Name())
+	w := httptest.NewRecorder()
+	BudgetAnalyzerHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("ack: status %d, %s", w.Code, w.Body)
+	}
+
+	// The cached analysis gets a new ETag, and the alert only shows with all
+	second, body := serveTestRequest(t, "GET", "/", http.Header{"If-None-Match": {first.Header().Get("ETag")}})
+	if second.Code != http.StatusOK {
+		t.Fatalf("GET after ack: status %d, want 200", second.Code)
+	}
+	if strings.Contains(second.Body.String(), id) {
+		t.Error("acknowledged alert still shown")
+	}
+	if _, body = serveTestRequest(t, "GET", "/?alerts=all", nil); !strings.Contains(strings.Join(alertStatuses(body), ","), "acknowledged") {
+		t.Errorf("alerts=all statuses = %v, want the acknowledged alert", alertStatuses(body))
+	}
+}
+
+func alertStatuses(body map[string]interface{}) []string {
+	var statuses []string
+	alerts, _ := body["data"].(map[string]interface{})["alerts"].([]interface{})
+	for _, alert := range alerts {
+		statuses = append(statuses, alert.(map[string]interface{})["status"].(string))
+	}
+	return statuses
+}
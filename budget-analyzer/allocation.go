@@ -0,0 +1,240 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Generation modes: "spending" derives budgets from past spending; the others
+// start from detected monthly income and split it across buckets
+var validGenerationModes = map[string]bool{
+	"spending":   true,
+	"50-30-20":   true,
+	"zero-based": true,
+	"custom":     true,
+}
+
+// Fixed income splits, in % of monthly income
+var fixedBucketSplits = map[string]map[string]float64{
+	"50-30-20": {bucketNeeds: 50, bucketWants: 30, bucketSavings: 20},
+}
+
+// Parses a custom split such as "needs:60,wants:25,savings:15". Buckets left
+// out get nothing; the percentages must add up to 100.
+func parseBucketSplit(value string) (map[string]float64, []FieldError) {
+	split := make(map[string]float64)
+	total := 0.0
+
+	for _, part := range strings.Split(value, ",") {
+		bucket, rawShare, ok := strings.Cut(strings.TrimSpace(part), ":")
+		bucket = strings.ToLower(strings.TrimSpace(bucket))
+		if !ok || !validBuckets[bucket] {
+			return nil, []FieldError{{Field: "split", Message: "must list bucket:percent pairs for needs, wants, savings, e.g. needs:60,wants:25,savings:15"}}
+		}
+		if _, seen := split[bucket]; seen {
+			return nil, []FieldError{{Field: "split", Message: "lists " + bucket + " more than once"}}
+		}
+		share, err := strconv.ParseFloat(strings.TrimSpace(rawShare), 64)
+		if err != nil || share < 0 || math.IsInf(share, 0) {
+			return nil, []FieldError{{Field: "split", Message: "percentage for " + bucket + " must be a non-negative number"}}
+		}
+		split[bucket] = share
+		total += share
+	}
+
+	if math.Abs(total-100) > 0.01 {
+		return nil, []FieldError{{Field: "split", Message: "percentages must add up to 100"}}
+	}
+	return split, nil
+}
+
+// Typical monthly income: the median over the source months
+func detectMonthlyIncome(history monthlyHistory) float64 {
+	return median(history.incomeValues())
+}
+
+func noIncomeError(mode string) error {
+	return validationError([]FieldError{{Field: "mode", Message: mode + " budgets need income transactions in the lookback window"}})
+}
+
+// Budgets for the configured generation mode
+func generateBudgets(transactions []Transaction, opts generationOptions) ([]Budget, error) {
+	switch opts.Mode {
+	case "50-30-20":
+		return generateBudgetsFromSplit(transactions, opts, fixedBucketSplits[opts.Mode])
+	case "custom":
+		return generateBudgetsFromSplit(transactions, opts, opts.Split)
+	case "zero-based":
+		return generateZeroBasedBudgets(transactions, opts)
+	default:
+		return generateBudgetsFromSpending(transactions, opts), nil
+	}
+}
+
+// One category's typical month and its bucket, the input to an allocation
+type categoryAllocation struct {
+	category string
+	bucket   string
+	typical  float64
+	amount   float64
+}
+
+// Typical (median, outliers excluded) monthly spend for every category with
+// spending, grouped by bucket
+func typicalSpendingByBucket(history monthlyHistory, overrides map[string]string) map[string][]*categoryAllocation {
+	byBucket := make(map[string][]*categoryAllocation)
+	for _, category := range history.categories() {
+		typical, _, _ := categoryStatistic(history, category, 50)
+		if typical <= 0 {
+			continue
+		}
+		bucket := bucketFor(category, overrides)
+		byBucket[bucket] = append(byBucket[bucket], &categoryAllocation{category: category, bucket: bucket, typical: typical})
+	}
+	return byBucket
+}
+
+func sumTypical(allocations []*categoryAllocation) float64 {
+	total := 0.0
+	for _, allocation := range allocations {
+		total += allocation.typical
+	}
+	return total
+}
+
+// Splits income across buckets by percentage, then each bucket across its
+// categories in proportion to their typical spend. A bucket with no spending
+// categories becomes a single budget named after the bucket.
+func generateBudgetsFromSplit(transactions []Transaction, opts generationOptions, split map[string]float64) ([]Budget, error) {
+	history := buildMonthlyHistory(transactions, sourceMonths(transactions, opts.Now, opts.LookbackMonths))
+	income := detectMonthlyIncome(history)
+	if income <= 0 {
+		return nil, noIncomeError(opts.Mode)
+	}
+
+	byBucket := typicalSpendingByBucket(history, opts.Buckets)
+
+	var allocations []*categoryAllocation
+	for _, bucket := range budgetBuckets {
+		share := income * split[bucket] / 100
+		if share <= 0 {
+			continue
+		}
+
+		members := byBucket[bucket]
+		total := sumTypical(members)
+		if total <= 0 {
+			allocations = append(allocations, &categoryAllocation{category: bucket, bucket: bucket, amount: share})
+			continue
+		}
+		for _, member := range members {
+			member.amount = share * member.typical / total
+			allocations = append(allocations, member)
+		}
+	}
+
+	return allocationBudgets(allocations, opts, history, income), nil
+}
+
+// Gives every unit of income a job: each category starts at its typical
+// spend; any surplus goes to savings, and a shortfall is cut from wants
+// first, then savings, then needs, until allocations equal income.
+func generateZeroBasedBudgets(transactions []Transaction, opts generationOptions) ([]Budget, error) {
+	history := buildMonthlyHistory(transactions, sourceMonths(transactions, opts.Now, opts.LookbackMonths))
+	income := detectMonthlyIncome(history)
+	if income <= 0 {
+		return nil, noIncomeError(opts.Mode)
+	}
+
+	byBucket := typicalSpendingByBucket(history, opts.Buckets)
+
+	spent := 0.0
+	for _, bucket := range budgetBuckets {
+		for _, member := range byBucket[bucket] {
+			member.amount = member.typical
+			spent += member.typical
+		}
+	}
+
+	if surplus := income - spent; surplus >= 0 {
+		savings := byBucket[bucketSavings]
+		if total := sumTypical(savings); total > 0 {
+			for _, member := range savings {
+				member.amount += surplus * member.typical / total
+			}
+		} else if surplus > 0 {
+			byBucket[bucketSavings] = []*categoryAllocation{{category: bucketSavings, bucket: bucketSavings, amount: surplus}}
+		}
+	} else {
+		shortfall := -surplus
+		for _, bucket := range []string{bucketWants, bucketSavings, bucketNeeds} {
+			members := byBucket[bucket]
+			total := sumTypical(members)
+			if total <= 0 || shortfall <= 0 {
+				continue
+			}
+			cut := math.Min(shortfall, total)
+			for _, member := range members {
+				member.amount -= cut * member.typical / total
+			}
+			shortfall -= cut
+		}
+	}
+
+	var allocations []*categoryAllocation
+	for _, bucket := range budgetBuckets {
+		allocations = append(allocations, byBucket[bucket]...)
+	}
+
+	budgets := allocationBudgets(allocations, opts, history, income)
+
+	// Keep the total equal to income despite rounding to cents
+	if len(budgets) > 0 {
+		allocated := 0.0
+		largest := 0
+		for i, budget := range budgets {
+			allocated += budget.Amount
+			if budget.Amount > budgets[largest].Amount {
+				largest = i
+			}
+		}
+		drift := math.Round((income-allocated)*100) / 100
+		budgets[largest].Amount = math.Round((budgets[largest].Amount+drift)*100) / 100
+	}
+
+	return budgets, nil
+}
+
+// Turns allocations into monthly budgets, dropping any that came to nothing
+func allocationBudgets(allocations []*categoryAllocation, opts generationOptions, history monthlyHistory, income float64) []Budget {
+	sort.SliceStable(allocations, func(i, j int) bool {
+		return allocations[i].category < allocations[j].category
+	})
+
+	var budgets []Budget
+	for _, allocation := range allocations {
+		amount := math.Round(allocation.amount*100) / 100
+		if amount <= 0 {
+			continue
+		}
+
+		budgets = append(budgets, Budget{
+			ID:       len(budgets) + 1,
+			Category: allocation.category,
+			Amount:   amount,
+			Period:   "monthly",
+			Suggestion: &BudgetSuggestion{
+				Method:           opts.Mode,
+				MonthlyStatistic: math.Round(allocation.typical*100) / 100,
+				SourceMonths:     history.monthKeys(),
+				Bucket:           allocation.bucket,
+				IncomeShare:      math.Round(amount/income*10000) / 100,
+				MonthlyIncome:    math.Round(income*100) / 100,
+			},
+		})
+	}
+
+	return budgets
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Buckets that income-based budgets are split across
+const (
+	bucketNeeds   = "needs"
+	bucketWants   = "wants"
+	bucketSavings = "savings"
+)
+
+var budgetBuckets = []string{bucketNeeds, bucketWants, bucketSavings}
+
+var validBuckets = map[string]bool{
+	bucketNeeds:   true,
+	bucketWants:   true,
+	bucketSavings: true,
+}
+
+const bucketMappingNamespace = "bucket-mappings"
+
+// Where each known category falls; anything else counts as a want
+var defaultCategoryBuckets = map[string]string{
+	"housing":        bucketNeeds,
+	"rent":           bucketNeeds,
+	"utilities":      bucketNeeds,
+	"food":           bucketNeeds,
+	"groceries":      bucketNeeds,
+	"transportation": bucketNeeds,
+	"healthcare":     bucketNeeds,
+	"insurance":      bucketNeeds,
+	"education":      bucketNeeds,
+	"childcare":      bucketNeeds,
+	"entertainment":  bucketWants,
+	"shopping":       bucketWants,
+	"dining":         bucketWants,
+	"travel":         bucketWants,
+	"subscriptions":  bucketWants,
+	"other":          bucketWants,
+	"savings":        bucketSavings,
+	"investments":    bucketSavings,
+	"debt":           bucketSavings,
+	"loans":          bucketSavings,
+}
+
+// A user's category-to-bucket overrides, keyed by lower-cased category
+type bucketMappingRequest struct {
+	Mappings map[string]string `json:"mappings"`
+}
+
+func normalizeCategoryKey(category string) string {
+	return strings.ToLower(canonicalCategory(category))
+}
+
+// Bucket for a category: the nearest level of its hierarchy with a mapping,
+// preferring the user's overrides over the defaults at each level
+func bucketFor(category string, overrides map[string]string) string {
+	path := categoryPath(category)
+	for i := len(path) - 1; i >= 0; i-- {
+		key := normalizeCategoryKey(path[i])
+		if bucket, ok := overrides[key]; ok {
+			return bucket
+		}
+		if bucket, ok := defaultCategoryBuckets[key]; ok {
+			return bucket
+		}
+	}
+	return bucketWants
+}
+
+func loadBucketOverrides(userID string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	if _, err := documents.Load(bucketMappingNamespace, userID, &overrides); err != nil {
+		return nil, wrapAPIError(CodeInternal, "Bucket mapping storage is unavailable", err)
+	}
+	return overrides, nil
+}
+
+func validateBucketMappings(mappings map[string]string) []FieldError {
+	var details []FieldError
+	if len(mappings) > maxBudgets {
+		details = append(details, FieldError{Field: "mappings", Message: fmt.Sprintf("must contain at most %d categories", maxBudgets)})
+	}
+
+	categories := make([]string, 0, len(mappings))
+	for category := range mappings {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	for _, category := range categories {
+		field := fmt.Sprintf("mappings[%s]", category)
+		switch key := normalizeCategoryKey(category); {
+		case key == "":
+			details = append(details, FieldError{Field: field, Message: "category is required"})
+		case len(key) > maxCategoryLength:
+			details = append(details, FieldError{Field: field, Message: fmt.Sprintf("category must be at most %d characters", maxCategoryLength)})
+		}
+		if !validBuckets[mappings[category]] {
+			details = append(details, FieldError{Field: field, Message: "must be one of needs, wants, savings"})
+		}
+	}
+	return details
+}
+
+// The authenticated user's category-to-bucket mapping:
+//
+//	GET    ?action=bucket-mapping    defaults merged with overrides
+//	PUT    ?action=bucket-mapping    replace overrides, {"mappings": {"dining": "wants"}}
+//	DELETE ?action=bucket-mapping    reset to defaults
+func handleBucketMapping(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, _, err := requireAuth(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var request bucketMappingRequest
+		hasBody, decodeErr := decodeJSONBody(w, r, &request)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+		if details := validateBucketMappings(request.Mappings); len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+
+		overrides := make(map[string]string, len(request.Mappings))
+		for category, bucket := range request.Mappings {
+			overrides[normalizeCategoryKey(category)] = bucket
+		}
+		if err := documents.Save(bucketMappingNamespace, userID, overrides); err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Bucket mapping storage is unavailable", err))
+			return
+		}
+		userAnalyses.invalidate(userID)
+	case "DELETE":
+		if err := documents.Delete(bucketMappingNamespace, userID); err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Bucket mapping storage is unavailable", err))
+			return
+		}
+		userAnalyses.invalidate(userID)
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	overrides, err := loadBucketOverrides(userID)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	effective := make(map[string]string, len(defaultCategoryBuckets)+len(overrides))
+	for category, bucket := range defaultCategoryBuckets {
+		effective[category] = bucket
+	}
+	for category, bucket := range overrides {
+		effective[category] = bucket
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"mappings":       effective,
+			"overrides":      overrides,
+			"default_bucket": bucketWants,
+		},
+		"computed_at": time.Now().Unix(),
+		"function":    "budget-analyzer",
+		"runtime":     "Go",
+	})
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const userBudgetsNamespace = "budgets"
+
+var (
+	errBudgetNotFound    = errors.New("budget not found")
+	errDuplicateCategory = errors.New("a budget for this category already exists")
+	errTooManyBudgets    = errors.New("budget limit reached")
+)
+
+var budgetStore BudgetStore = NewDocumentBudgetStore(documents)
+
+// BudgetStore persists user-defined budgets, scoped per user
+type BudgetStore interface {
+	List(userID string) ([]Budget, error)
+	Get(userID string, id int) (Budget, error)
+	Create(userID string, budget Budget) (Budget, error)
+	Update(userID string, budget Budget) (Budget, error)
+	Delete(userID string, id int) error
+}
+
+// Stored form of one user's budgets
+type userBudgets struct {
+	NextID  int      `json:"next_id"`
+	Budgets []Budget `json:"budgets"`
+}
+
+// DocumentBudgetStore keeps each user's budgets as a single document in a
+// DocumentStore, so it is in-memory or file-backed depending on the store
+type DocumentBudgetStore struct {
+	docs DocumentStore
+	mu   sync.Mutex // serializes read-modify-write cycles
+}
+
+func NewDocumentBudgetStore(docs DocumentStore) *DocumentBudgetStore {
+	return &DocumentBudgetStore{docs: docs}
+}
+
+func NewMemoryBudgetStore() *DocumentBudgetStore {
+	return NewDocumentBudgetStore(NewMemoryDocumentStore())
+}
+
+func NewFileBudgetStore(dir string) *DocumentBudgetStore {
+	return NewDocumentBudgetStore(NewFileDocumentStore(dir))
+}
+
+func (s *DocumentBudgetStore) load(userID string) (userBudgets, error) {
+	doc := userBudgets{NextID: 1}
+	if _, err := s.docs.Load(userBudgetsNamespace, userID, &doc); err != nil {
+		return doc, err
+	}
+	return doc, nil
+}
+
+func (s *DocumentBudgetStore) List(userID string) ([]Budget, error) {
+	doc, err := s.load(userID)
+	return doc.Budgets, err
+}
+
+func (s *DocumentBudgetStore) Get(userID string, id int) (Budget, error) {
+	doc, err := s.load(userID)
+	if err != nil {
+		return Budget{}, err
+	}
+	for _, budget := range doc.Budgets {
+		if budget.ID == id {
+			return budget, nil
+		}
+	}
+	return Budget{}, errBudgetNotFound
+}
+
+// Read-modify-write of a user's budgets
+func (s *DocumentBudgetStore) modify(userID string, change func(doc *userBudgets) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, err := s.load(userID)
+	if err != nil {
+		return err
+	}
+	if err := change(&doc); err != nil {
+		return err
+	}
+	return s.docs.Save(userBudgetsNamespace, userID, doc)
+}
+
+func (s *DocumentBudgetStore) Create(userID string, budget Budget) (Budget, error) {
+	err := s.modify(userID, func(doc *userBudgets) error {
+		if len(doc.Budgets) >= maxBudgets {
+			return errTooManyBudgets
+		}
+		if categoryTaken(doc.Budgets, budget.Category, 0) {
+			return errDuplicateCategory
+		}
+		budget = defaultRolloverFrom(budget, nil, time.Now())
+		budget.ID = doc.NextID
+		doc.NextID++
+		doc.Budgets = append(doc.Budgets, budget)
+		return nil
+	})
+	return budget, err
+}
+
+func (s *DocumentBudgetStore) Update(userID string, budget Budget) (Budget, error) {
+	err := s.modify(userID, func(doc *userBudgets) error {
+		if categoryTaken(doc.Budgets, budget.Category, budget.ID) {
+			return errDuplicateCategory
+		}
+		for i := range doc.Budgets {
+			if doc.Budgets[i].ID == budget.ID {
+				budget = defaultRolloverFrom(budget, &doc.Budgets[i], time.Now())
+				doc.Budgets[i] = budget
+				return nil
+			}
+		}
+		return errBudgetNotFound
+	})
+	return budget, err
+}
+
+func (s *DocumentBudgetStore) Delete(userID string, id int) error {
+	return s.modify(userID, func(doc *userBudgets) error {
+		for i := range doc.Budgets {
+			if doc.Budgets[i].ID == id {
+				doc.Budgets = append(doc.Budgets[:i], doc.Budgets[i+1:]...)
+				return nil
+			}
+		}
+		return errBudgetNotFound
+	})
+}
+
+// Categories are unique per user, ignoring case and delimiter spacing; exceptID is the budget being updated
+func categoryTaken(budgets []Budget, category string, exceptID int) bool {
+	key := strings.ToLower(canonicalCategory(category))
+	for _, budget := range budgets {
+		if budget.ID != exceptID && strings.ToLower(canonicalCategory(budget.Category)) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Maps budget store failures onto the error envelope
+func budgetStoreError(err error) error {
+	switch {
+	case errors.Is(err, errBudgetNotFound):
+		return newAPIError(CodeNotFound, "Budget not found")
+	case errors.Is(err, errDuplicateCategory):
+		return newAPIError(CodeConflict, "A budget for this category already exists")
+	case errors.Is(err, errTooManyBudgets):
+		return validationError([]FieldError{{Field: "budgets", Message: fmt.Sprintf("must contain at most %d budgets", maxBudgets)}})
+	}
+	return wrapAPIError(CodeInternal, "Budget storage is unavailable", err)
+}
+
+// User budgets when any are stored, otherwise budgets generated from spending
+func budgetsForUser(userID string, transactions []Transaction, genOpts generationOptions) ([]Budget, string, error) {
+	stored, err := budgetStore.List(userID)
+	if err != nil {
+		return nil, "", budgetStoreError(err)
+	}
+	if len(stored) > 0 {
+		return stored, "stored", nil
+	}
+
+	if genOpts.Mode != "spending" {
+		if genOpts.Buckets, err = loadBucketOverrides(userID); err != nil {
+			return nil, "", err
+		}
+	}
+	budgets, err := generateBudgets(transactions, genOpts)
+	if err != nil {
+		return nil, "", err
+	}
+	return budgets, "generated", nil
+}
+
+// CRUD for the authenticated user's budgets:
+//
+//	GET    ?action=budgets         list
+//	GET    ?action=budgets&id=N    fetch one
+//	POST   ?action=budgets         create
+//	PUT    ?action=budgets&id=N    replace
+//	DELETE ?action=budgets&id=N    delete
+func handleBudgets(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, _, err := requireAuth(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	var id int
+	if rawID := r.URL.Query().Get("id"); rawID != "" || r.Method == "PUT" || r.Method == "DELETE" {
+		id, err = strconv.Atoi(rawID)
+		if err != nil || id <= 0 {
+			writeError(w, requestID, validationError([]FieldError{{Field: "id", Message: "must be a positive budget id"}}))
+			return
+		}
+	}
+
+	var result interface{}
+	status := http.StatusOK
+
+	switch r.Method {
+	case "GET":
+		if id > 0 {
+			budget, getErr := budgetStore.Get(userID, id)
+			if getErr != nil {
+				writeError(w, requestID, budgetStoreError(getErr))
+				return
+			}
+			result = budget
+			break
+		}
+
+		budgets, listErr := budgetStore.List(userID)
+		if listErr != nil {
+			writeError(w, requestID, budgetStoreError(listErr))
+			return
+		}
+		if budgets == nil {
+			budgets = []Budget{}
+		}
+		result = budgets
+
+	case "POST", "PUT":
+		var budget Budget
+		hasBody, decodeErr := decodeJSONBody(w, r, &budget)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+		if details := validateBudget("", budget); len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+
+		budget.Category = canonicalCategory(budget.Category)
+		budget.Suggestion = nil
+
+		var saveErr error
+		if r.Method == "POST" {
+			budget, saveErr = budgetStore.Create(userID, budget)
+			status = http.StatusCreated
+		} else {
+			budget.ID = id
+			budget, saveErr = budgetStore.Update(userID, budget)
+		}
+		if saveErr != nil {
+			writeError(w, requestID, budgetStoreError(saveErr))
+			return
+		}
+		result = budget
+
+	case "DELETE":
+		if deleteErr := budgetStore.Delete(userID, id); deleteErr != nil {
+			writeError(w, requestID, budgetStoreError(deleteErr))
+			return
+		}
+		result = map[string]interface{}{"id": id, "deleted": true}
+
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	// Stored budgets feed the analysis, so any change invalidates it
+	if r.Method != "GET" {
+		userAnalyses.invalidate(userID)
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"data":        result,
+		"computed_at": time.Now().Unix(),
+		"function":    "budget-analyzer",
+		"runtime":     "Go",
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default number of users whose computed budget analyses are kept in memory
+const defaultAnalysisCacheSize = 1000
+
+type cachedAnalysis struct {
+	etag       string
+	analysis   OverallBudgetHealth
+	budgets    []Budget
+	computedAt time.Time
+}
+
+type analysisCacheItem struct {
+	userID string
+	result cachedAnalysis
+}
+
+// analysisCache is a bounded LRU of the most recent analysis computed per user.
+// An entry is only reused while its ETag still matches the user's
+// transactions and budgets, so a stale entry can never be served.
+type analysisCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+var userAnalyses = newAnalysisCache(getAnalysisCacheSize())
+
+func getAnalysisCacheSize() int {
+	if value := os.Getenv("ANALYSIS_CACHE_SIZE"); value != "" {
+		if size, err := strconv.Atoi(value); err == nil && size > 0 {
+			return size
+		}
+	}
+	return defaultAnalysisCacheSize
+}
+
+func newAnalysisCache(capacity int) *analysisCache {
+	return &analysisCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *analysisCache) get(userID string) (cachedAnalysis, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[userID]
+	if !ok {
+		return cachedAnalysis{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*analysisCacheItem).result, true
+}
+
+func (c *analysisCache) put(userID string, result cachedAnalysis) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[userID]; ok {
+		elem.Value.(*analysisCacheItem).result = result
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[userID] = c.order.PushFront(&analysisCacheItem{userID: userID, result: result})
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*analysisCacheItem).userID)
+	}
+}
+
+// invalidate drops a user's cached analysis so the next request recomputes it
+func (c *analysisCache) invalidate(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[userID]; ok {
+		c.order.Remove(elem)
+		delete(c.items, userID)
+	}
+}
+
+// analysisETag fingerprints the inputs of an analysis independently of the
+// order transaction-api returned them in. The variant carries anything else
+// the result depends on, such as the analysis date and options.
+func analysisETag(transactions []Transaction, budgets []Budget, variant string) string {
+	lines := make([]string, 0, len(transactions)+len(budgets)+1)
+	lines = append(lines, "v|"+variant)
+	for _, t := range transactions {
+		lines = append(lines, fmt.Sprintf("t|%s|%s|%s|%.2f|%s|%s|%q|%s",
+			t.ID, t.UpdatedAt, t.Date, t.Amount, t.Type, t.Category, t.Description, strings.Join(t.Tags, ",")))
+	}
+	for _, b := range budgets {
+		lines = append(lines, fmt.Sprintf("b|%d|%s|%.2f|%s|%t|%.2f|%s|%g|%g", b.ID, b.Category, b.Amount, b.Period, b.Rollover, b.RolloverCap, b.RolloverFrom, b.WarningThreshold, b.CriticalThreshold))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Extends an ETag with state that doesn't change the analysis itself but does
+// change the response, such as which alerts are acknowledged
+func etagWithVariant(etag, variant string) string {
+	sum := sha256.Sum256([]byte(etag + "|" + variant))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Reports whether the request's If-None-Match header matches etag
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnalysisCacheLRU(t *testing.T) {
+	cache := newAnalysisCache(2)
+	cache.put("a", cachedAnalysis{etag: "1"})
+	cache.put("b", cachedAnalysis{etag: "2"})
+	cache.get("a") // a is now the most recent
+	cache.put("c", cachedAnalysis{etag: "3"})
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("least recently used entry wasn't evicted")
+	}
+	for _, userID := range []string{"a", "c"} {
+		if _, ok := cache.get(userID); !ok {
+			t.Errorf("%s was evicted", userID)
+		}
+	}
+
+	cache.put("a", cachedAnalysis{etag: "4"})
+	if result, _ := cache.get("a"); result.etag != "4" || cache.order.Len() != 2 {
+		t.Errorf("replacing an entry: etag %s with %d entries, want 4 with 2", result.etag, cache.order.Len())
+	}
+
+	cache.invalidate("a")
+	if _, ok := cache.get("a"); ok || cache.order.Len() != 1 {
+		t.Errorf("invalidated entry still cached, %d entries", cache.order.Len())
+	}
+}
+
+func TestAnalysisETag(t *testing.T) {
+	transactions := []Transaction{
+		{ID: "t1", Amount: 12.5, Category: "Dining", Date: "2026-10-02", Type: "expense"},
+		{ID: "t2", Amount: 80, Category: "Groceries", Date: "2026-10-03", Type: "expense"},
+	}
+	budgets := []Budget{{ID: 1, Category: "Dining", Amount: 200, Period: "monthly"}}
+	base := analysisETag(transactions, budgets, "v")
+
+	reordered := []Transaction{transactions[1], transactions[0]}
+	if analysisETag(reordered, budgets, "v") != base {
+		t.Error("ETag depends on the order of transactions")
+	}
+
+	edited := append([]Transaction{}, transactions...)
+	edited[0].Amount = 13
+	retuned := []Budget{budgets[0]}
+	retuned[0].WarningThreshold = 70
+
+	for name, etag := range map[string]string{
+		"edited transaction": analysisETag(edited, budgets, "v"),
+		"new transaction":    analysisETag(append(transactions, Transaction{ID: "t3"}), budgets, "v"),
+		"budget thresholds":  analysisETag(transactions, retuned, "v"),
+		"variant":            analysisETag(transactions, budgets, "w"),
+	} {
+		if etag == base {
+			t.Errorf("%s doesn't change the ETag", name)
+		}
+	}
+	if etagWithVariant(base, "acked") == etagWithVariant(base, "new") {
+		t.Error("response variant doesn't change the ETag")
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := `"abc"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{"*", true},
+		{`"xyz"`, false},
+		{`abc`, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set("If-None-Match", tt.header)
+		}
+		if got := etagMatches(r, etag); got != tt.want {
+			t.Errorf("If-None-Match %q: etagMatches = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestConditionalAnalysis(t *testing.T) {
+	userID := "etag-test-user"
+	services := newTestServices(t, userID, []Transaction{
+		{ID: "t1", Category: "Dining", Amount: 40, Date: "2026-10-02", Type: "expense", UpdatedAt: "2026-10-02T10:00:00.000Z"},
+	})
+	if _, err := budgetStore.Create(userID, Budget{Category: "Dining", Amount: 300, Period: "monthly"}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, body := serveTestRequest(t, "GET", "/", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || body["cached"] != false {
+		t.Fatalf("first GET: status %d, ETag %q, cached %v", first.Code, etag, body["cached"])
+	}
+
+	// Unchanged: 304, and a plain GET reuses the cached analysis
+	if w, _ := serveTestRequest(t, "GET", "/", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Errorf("unchanged GET with If-None-Match: status %d, want 304", w.Code)
+	}
+	if _, body := serveTestRequest(t, "GET", "/", nil); body["cached"] != true {
+		t.Errorf("unchanged GET: cached %v, want true", body["cached"])
+	}
+
+	// An edited transaction or budget changes the ETag
+	services.transactions[0].Amount = 45
+	services.transactions[0].UpdatedAt = "2026-10-03T10:00:00.000Z"
+	w, _ := serveTestRequest(t, "GET", "/", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("GET after a transaction edit: status %d with ETag %s, want 200 with a new one", w.Code, w.Header().Get("ETag"))
+	}
+	etag = w.Header().Get("ETag")
+
+	r := httptest.NewRequest("POST", "/?action=budgets", strings.NewReader(`{"category":"Groceries","amount":400,"period":"monthly"}`))
+	r.Header.Set("Authorization", "Bearer token-"+t.Name())
+	created := httptest.NewRecorder()
+	BudgetAnalyzerHandler(created, r)
+	if created.Code != http.StatusCreated && created.Code != http.StatusOK {
+		t.Fatalf("creating a budget: status %d, %s", created.Code, created.Body)
+	}
+
+	if w, _ := serveTestRequest(t, "GET", "/", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusOK {
+		t.Errorf("GET after a new budget: status %d, want 200", w.Code)
+	}
+}
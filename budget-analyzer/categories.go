@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// Categories form a hierarchy. "Food > Groceries" is a child of "Food" by
+// its delimiter (CATEGORY_DELIMITER, default ">"), and CATEGORY_TREE can
+// place plain categories under a parent, e.g. {"groceries": "food"}.
+var categoryTree = loadCategoryTree()
+
+// Deepest hierarchy followed through CATEGORY_TREE, guarding against cycles
+const maxCategoryDepth = 10
+
+func getCategoryDelimiter() string {
+	if delimiter := strings.TrimSpace(os.Getenv("CATEGORY_DELIMITER")); delimiter != "" {
+		return delimiter
+	}
+	return ">"
+}
+
+// Child -> parent pairs from CATEGORY_TREE, keyed by lower-cased child
+func loadCategoryTree() map[string]string {
+	tree := make(map[string]string)
+	raw := os.Getenv("CATEGORY_TREE")
+	if raw == "" {
+		return tree
+	}
+
+	var configured map[string]string
+	if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+		log.Printf("budget-analyzer: ignoring invalid CATEGORY_TREE: %v", err)
+		return tree
+	}
+	for child, parent := range configured {
+		if parent = strings.TrimSpace(parent); parent != "" {
+			tree[strings.ToLower(strings.TrimSpace(child))] = parent
+		}
+	}
+	return tree
+}
+
+// Category with consistent spacing around delimiters, so "Food>Groceries"
+// and "Food > Groceries" are the same category
+func canonicalCategory(category string) string {
+	delimiter := getCategoryDelimiter()
+
+	var segments []string
+	for _, segment := range strings.Split(category, delimiter) {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, " "+delimiter+" ")
+}
+
+// The category and its ancestors, root first: "Food > Groceries" gives
+// ["Food", "Food > Groceries"]
+func categoryPath(category string) []string {
+	delimiter := getCategoryDelimiter()
+	canonical := canonicalCategory(category)
+	if canonical == "" {
+		return nil
+	}
+
+	segments := strings.Split(canonical, " "+delimiter+" ")
+	path := make([]string, len(segments))
+	for i := range segments {
+		path[i] = strings.Join(segments[:i+1], " "+delimiter+" ")
+	}
+
+	// Configured parents of the top-level category
+	seen := map[string]bool{strings.ToLower(path[0]): true}
+	for len(path) < maxCategoryDepth {
+		parent, ok := categoryTree[strings.ToLower(path[0])]
+		if !ok || seen[strings.ToLower(parent)] {
+			break
+		}
+		seen[strings.ToLower(parent)] = true
+		path = append([]string{canonicalCategory(parent)}, path...)
+	}
+
+	return path
+}
+
+// Reports whether the category with this path is ancestor (canonical) or
+// one of its descendants
+func categoryWithin(path []string, ancestor string) bool {
+	for _, node := range path {
+		if strings.EqualFold(node, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// Links each budget to its nearest budgeted ancestor and carries overspending
+// up the tree: every budgeted ancestor of an over-budget subcategory lists it
+// and is at least a warning. Returns alerts for periods still in progress.
+func linkBudgetHierarchy(analyses []BudgetAnalysis, now time.Time) []Alert {
+	index := make(map[string]int, len(analyses))
+	for i, analysis := range analyses {
+		index[strings.ToLower(canonicalCategory(analysis.Category))] = i
+	}
+
+	for i := range analyses {
+		path := categoryPath(analyses[i].Category)
+		for j := len(path) - 2; j >= 0; j-- {
+			k, ok := index[strings.ToLower(path[j])]
+			if !ok {
+				continue
+			}
+			if analyses[i].Parent == "" {
+				analyses[i].Parent = analyses[k].Category
+			}
+			if analyses[i].Status == "over_budget" {
+				analyses[k].OverspentChildren = append(analyses[k].OverspentChildren, analyses[i].Category)
+			}
+		}
+	}
+
+	var alerts []Alert
+	for i := range analyses {
+		analysis := &analyses[i]
+		if len(analysis.OverspentChildren) == 0 || analysis.Status == "over_budget" {
+			continue
+		}
+		if analysis.Status == "on_track" {
+			analysis.Status = "warning"
+			if analysis.Verdict == "" {
+				analysis.Recommendation = "🔶 A subcategory is over budget - rebalance within " + analysis.Category
+			}
+		}
+		if analysis.Verdict == "" {
+			alert := newAlert(alertSubcategoryOver, analysis.Category, alertLevelWarning, analysis.PeriodStart, now)
+			alert.Threshold = 100
+			alert.PercentageUsed = analysis.PercentageUsed
+			alert.Amount = math.Round(analysis.Spent*100) / 100
+			alert.Budgeted = analysis.Budgeted
+			alert.Message = analysis.Category + " has an over-budget subcategory: " + strings.Join(analysis.OverspentChildren, ", ")
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
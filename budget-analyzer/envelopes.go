@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	envelopeLedgerNamespace = "envelope-ledgers"
+	maxEnvelopeMoves        = 200 // most recent moves kept in the ledger
+)
+
+var validEnvelopeOps = map[string]bool{"assign": true, "move": true, "release": true}
+
+// Serializes read-modify-write cycles on envelope ledgers
+var envelopeLedgerMu sync.Mutex
+
+// EnvelopeLedger is a user's envelope budget: income received since StartDate
+// funds the unassigned pool, and Assigned records how much of it each
+// envelope holds. Balances live in Assigned, so trimming Moves loses only
+// history, never money.
+type EnvelopeLedger struct {
+	StartDate string             `json:"start_date"` // YYYY-MM-DD
+	Assigned  map[string]float64 `json:"assigned"`   // envelope -> net amount assigned
+	Moves     []EnvelopeMove     `json:"moves"`      // oldest first
+	NextID    int                `json:"next_id"`
+}
+
+// One recorded change to the envelopes. An empty From or To is the
+// unassigned pool.
+type EnvelopeMove struct {
+	ID     int       `json:"id"`
+	Op     string    `json:"op"` // assign, move, release
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to,omitempty"`
+	Amount float64   `json:"amount"`
+	Note   string    `json:"note,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Envelope is one category's balance. Spending in a subcategory comes out of
+// the nearest envelope up its hierarchy, and an envelope whose category has
+// a budget is linked to it.
+type Envelope struct {
+	Category  string  `json:"category"`
+	Assigned  float64 `json:"assigned"`
+	Spent     float64 `json:"spent"`
+	Available float64 `json:"available"` // assigned - spent
+	Status    string  `json:"status"`    // funded, empty, overdrawn
+	BudgetID  int     `json:"budget_id,omitempty"`
+	Budgeted  float64 `json:"budgeted,omitempty"` // the budget's monthly equivalent, what to assign each month
+}
+
+type EnvelopeReport struct {
+	StartDate  string         `json:"start_date"`
+	Income     float64        `json:"income"`     // received since start_date
+	Assigned   float64        `json:"assigned"`   // held in envelopes
+	Unassigned float64        `json:"unassigned"` // income not yet given a job
+	Spent      float64        `json:"spent"`
+	Envelopes  []Envelope     `json:"envelopes"`
+	Overdrawn  []string       `json:"overdrawn"`
+	Alerts     []Alert        `json:"alerts"`
+	Moves      []EnvelopeMove `json:"moves"`
+}
+
+// Body of an envelope change:
+//
+//	{"op": "assign", "to": "food", "amount": 300}             pool -> envelope
+//	{"op": "move", "from": "food", "to": "fun", "amount": 50} envelope -> envelope
+//	{"op": "release", "from": "food", "amount": 20}           envelope -> pool
+type envelopeOpRequest struct {
+	Op        string  `json:"op"`
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Amount    float64 `json:"amount"`
+	Note      string  `json:"note"`
+	StartDate string  `json:"start_date"` // only when starting a new ledger
+}
+
+func loadEnvelopeLedger(userID string) (EnvelopeLedger, bool, error) {
+	var ledger EnvelopeLedger
+	found, err := documents.Load(envelopeLedgerNamespace, userID, &ledger)
+	if err != nil {
+		return ledger, false, wrapAPIError(CodeInternal, "Envelope storage is unavailable", err)
+	}
+	if ledger.Assigned == nil {
+		ledger.Assigned = make(map[string]float64)
+	}
+	return ledger, found, nil
+}
+
+// The envelope a category's spending comes out of: the deepest envelope the
+// category is within, or the category's own when none holds money
+func envelopeFor(category string, assigned map[string]float64) string {
+	path := categoryPath(category)
+	match, depth := "", 0
+	for envelope := range assigned {
+		if envelopeDepth := len(categoryPath(envelope)); envelopeDepth > depth && categoryWithin(path, envelope) {
+			match, depth = envelope, envelopeDepth
+		}
+	}
+	if match == "" {
+		return normalizeCategoryKey(category)
+	}
+	return match
+}
+
+// Funds and spending since the ledger's start date, per envelope, linked to
+// the budgets of the same categories
+func buildEnvelopeReport(ledger EnvelopeLedger, transactions []Transaction, budgets []Budget, now time.Time) EnvelopeReport {
+	report := EnvelopeReport{StartDate: ledger.StartDate, Envelopes: []Envelope{}, Overdrawn: []string{}, Alerts: []Alert{}, Moves: ledger.Moves}
+	if report.Moves == nil {
+		report.Moves = []EnvelopeMove{}
+	}
+	start, _ := time.ParseInLocation("2006-01-02", ledger.StartDate, now.Location())
+
+	spent := make(map[string]float64)
+	for _, transaction := range transactions {
+		at, err := parseTransactionDate(transaction.Date)
+		if err != nil || at.Before(start) {
+			continue
+		}
+		switch transaction.Type {
+		case "income":
+			report.Income += transaction.Amount
+		case "expense":
+			spent[envelopeFor(transaction.Category, ledger.Assigned)] += transaction.Amount
+			report.Spent += transaction.Amount
+		}
+	}
+
+	// Every envelope with money in it, plus any category spent from without one
+	categories := make(map[string]bool)
+	for category := range ledger.Assigned {
+		categories[category] = true
+	}
+	for category := range spent {
+		categories[category] = true
+	}
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+
+	budgetsByCategory := make(map[string]Budget, len(budgets))
+	for _, budget := range budgets {
+		budgetsByCategory[normalizeCategoryKey(budget.Category)] = budget
+	}
+
+	for _, category := range names {
+		assigned := ledger.Assigned[category]
+		available := math.Round((assigned-spent[category])*100) / 100
+		status := "funded"
+		switch {
+		case available < 0:
+			status = "overdrawn"
+			report.Overdrawn = append(report.Overdrawn, category)
+			alert := newAlert(alertEnvelopeOverdrawn, category, alertLevelCritical, ledger.StartDate, now)
+			alert.Amount = math.Round(spent[category]*100) / 100
+			alert.Budgeted = math.Round(assigned*100) / 100
+			alert.Message = fmt.Sprintf("%s envelope is overdrawn by $%.2f", category, -available)
+			report.Alerts = append(report.Alerts, alert)
+		case available == 0:
+			status = "empty"
+		}
+
+		report.Assigned += assigned
+		envelope := Envelope{
+			Category:  category,
+			Assigned:  math.Round(assigned*100) / 100,
+			Spent:     math.Round(spent[category]*100) / 100,
+			Available: available,
+			Status:    status,
+		}
+		if budget, ok := budgetsByCategory[category]; ok {
+			envelope.BudgetID = budget.ID
+			envelope.Budgeted = math.Round(monthlyEquivalent(budget.Amount, normalizePeriod(budget.Period), now, getWeekStart())*100) / 100
+		}
+		report.Envelopes = append(report.Envelopes, envelope)
+	}
+
+	report.Unassigned = math.Round((report.Income-report.Assigned)*100) / 100
+	report.Income = math.Round(report.Income*100) / 100
+	report.Assigned = math.Round(report.Assigned*100) / 100
+	report.Spent = math.Round(report.Spent*100) / 100
+
+	if report.Unassigned < 0 {
+		alert := newAlert(alertEnvelopeOverassigned, "", alertLevelCritical, ledger.StartDate, now)
+		alert.Amount, alert.Budgeted = report.Assigned, report.Income
+		alert.Message = fmt.Sprintf("Envelopes hold $%.2f more than your income - release money back to the pool", -report.Unassigned)
+		report.Alerts = append(report.Alerts, alert)
+	} else if report.Unassigned > 0 {
+		alert := newAlert(alertEnvelopeUnassigned, "", alertLevelWarning, ledger.StartDate, now)
+		alert.Amount, alert.Budgeted = report.Unassigned, report.Income
+		alert.Message = fmt.Sprintf("$%.2f is unassigned - give it a job", report.Unassigned)
+		report.Alerts = append(report.Alerts, alert)
+	}
+
+	return report
+}
+
+func validateEnvelopeOp(request envelopeOpRequest) []FieldError {
+	var details []FieldError
+
+	if !validEnvelopeOps[request.Op] {
+		details = append(details, FieldError{Field: "op", Message: "must be one of assign, move, release"})
+		return details
+	}
+
+	from, to := normalizeCategoryKey(request.From), normalizeCategoryKey(request.To)
+	needsFrom, needsTo := request.Op != "assign", request.Op != "release"
+	for _, field := range []struct {
+		name   string
+		value  string
+		needed bool
+	}{{"from", from, needsFrom}, {"to", to, needsTo}} {
+		switch {
+		case field.needed && field.value == "":
+			details = append(details, FieldError{Field: field.name, Message: "is required for op=" + request.Op})
+		case !field.needed && field.value != "":
+			details = append(details, FieldError{Field: field.name, Message: "is not allowed for op=" + request.Op})
+		case len(field.value) > maxCategoryLength:
+			details = append(details, FieldError{Field: field.name, Message: fmt.Sprintf("must be at most %d characters", maxCategoryLength)})
+		}
+	}
+	if request.Op == "move" && from != "" && from == to {
+		details = append(details, FieldError{Field: "to", Message: "must differ from from"})
+	}
+
+	// Moves are recorded in cents, so the amount must be at least one once rounded
+	if math.Round(request.Amount*100) < 1 || math.IsInf(request.Amount, 0) || math.IsNaN(request.Amount) {
+		details = append(details, FieldError{Field: "amount", Message: "must be at least 0.01"})
+	}
+	if len(request.Note) > 200 {
+		details = append(details, FieldError{Field: "note", Message: "must be at most 200 characters"})
+	}
+	if request.StartDate != "" {
+		if _, err := time.Parse("2006-01-02", request.StartDate); err != nil {
+			details = append(details, FieldError{Field: "start_date", Message: "must be formatted as YYYY-MM-DD"})
+		}
+	}
+
+	return details
+}
+
+// Envelope budgeting for the authenticated user:
+//
+//	GET    ?action=envelopes    balances, unassigned money, overdrawn envelopes and their budgets
+//	POST   ?action=envelopes    assign, move or release money
+//	DELETE ?action=envelopes    start over
+func handleEnvelopes(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, authToken, err := requireAuth(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	now := time.Now()
+
+	var request envelopeOpRequest
+	switch r.Method {
+	case "GET":
+	case "POST":
+		hasBody, decodeErr := decodeJSONBody(w, r, &request)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+		if details := validateEnvelopeOp(request); len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+	case "DELETE":
+		envelopeLedgerMu.Lock()
+		err := documents.Delete(envelopeLedgerNamespace, userID)
+		envelopeLedgerMu.Unlock()
+		if err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Envelope storage is unavailable", err))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"data":     map[string]interface{}{"deleted": true},
+			"function": "budget-analyzer",
+			"runtime":  "Go",
+		})
+		return
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	transactions, err := fetchTransactions(authToken)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	budgets, err := budgetStore.List(userID)
+	if err != nil {
+		writeError(w, requestID, budgetStoreError(err))
+		return
+	}
+
+	envelopeLedgerMu.Lock()
+	defer envelopeLedgerMu.Unlock()
+
+	ledger, found, err := loadEnvelopeLedger(userID)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	if !found {
+		// A new ledger counts income from the start of the current month
+		ledger.StartDate = periodWindow("monthly", now, time.Monday).Start.Format("2006-01-02")
+		if request.StartDate != "" {
+			ledger.StartDate = request.StartDate
+		}
+	} else if request.StartDate != "" && request.StartDate != ledger.StartDate {
+		writeError(w, requestID, validationError([]FieldError{{Field: "start_date", Message: "can only be set when starting a new ledger"}}))
+		return
+	}
+
+	if r.Method == "POST" {
+		if err := applyEnvelopeOp(&ledger, request, buildEnvelopeReport(ledger, transactions, budgets, now), now); err != nil {
+			writeError(w, requestID, err)
+			return
+		}
+		if err := documents.Save(envelopeLedgerNamespace, userID, ledger); err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Envelope storage is unavailable", err))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":           true,
+		"data":              buildEnvelopeReport(ledger, transactions, budgets, now),
+		"transaction_count": len(transactions),
+		"computed_at":       now.Unix(),
+		"function":          "budget-analyzer",
+		"runtime":           "Go",
+	})
+}
+
+// Applies one change if the money is there: assignments come out of the
+// unassigned pool, moves and releases out of the source envelope's balance
+func applyEnvelopeOp(ledger *EnvelopeLedger, request envelopeOpRequest, current EnvelopeReport, now time.Time) error {
+	from, to := normalizeCategoryKey(request.From), normalizeCategoryKey(request.To)
+	amount := math.Round(request.Amount*100) / 100
+
+	if request.Op == "assign" {
+		if amount > current.Unassigned {
+			return newAPIError(CodeConflict, fmt.Sprintf("Only $%.2f is unassigned", math.Max(current.Unassigned, 0)))
+		}
+	} else {
+		available := 0.0
+		for _, envelope := range current.Envelopes {
+			if envelope.Category == from {
+				available = envelope.Available
+			}
+		}
+		if amount > available {
+			return newAPIError(CodeConflict, fmt.Sprintf("The %s envelope only has $%.2f available", from, math.Max(available, 0)))
+		}
+	}
+
+	if from != "" {
+		ledger.Assigned[from] = math.Round((ledger.Assigned[from]-amount)*100) / 100
+		if ledger.Assigned[from] == 0 {
+			delete(ledger.Assigned, from)
+		}
+	}
+	if to != "" {
+		ledger.Assigned[to] = math.Round((ledger.Assigned[to]+amount)*100) / 100
+	}
+
+	ledger.NextID++
+	ledger.Moves = append(ledger.Moves, EnvelopeMove{
+		ID:     ledger.NextID,
+		Op:     request.Op,
+		From:   from,
+		To:     to,
+		Amount: amount,
+		Note:   strings.TrimSpace(request.Note),
+		At:     now.UTC(),
+	})
+	if len(ledger.Moves) > maxEnvelopeMoves {
+		ledger.Moves = ledger.Moves[len(ledger.Moves)-maxEnvelopeMoves:]
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var envelopesNow = time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+func TestEnvelopeReportAlerts(t *testing.T) {
+	income := Transaction{Category: "Salary", Amount: 1000, Date: "2026-10-01", Type: "income"}
+
+	tests := []struct {
+		name     string
+		assigned map[string]float64
+		expenses []Transaction
+		want     []Alert // kind, category, level and message
+	}{
+		{
+			name:     "every dollar assigned and none overdrawn",
+			assigned: map[string]float64{"food": 600, "fun": 400},
+			expenses: []Transaction{{Category: "Food", Amount: 100, Date: "2026-10-03", Type: "expense"}},
+		},
+		{
+			name:     "overdrawn envelope",
+			assigned: map[string]float64{"food": 600, "fun": 400},
+			expenses: []Transaction{{Category: "Fun", Amount: 450.5, Date: "2026-10-03", Type: "expense"}},
+			want: []Alert{
+				{Kind: alertEnvelopeOverdrawn, Category: "fun", Level: alertLevelCritical, Message: "fun envelope is overdrawn by $50.50"},
+			},
+		},
+		{
+			name:     "money left unassigned",
+			assigned: map[string]float64{"food": 600},
+			want: []Alert{
+				{Kind: alertEnvelopeUnassigned, Level: alertLevelWarning, Message: "$400.00 is unassigned - give it a job"},
+			},
+		},
+		{
+			name:     "more assigned than received",
+			assigned: map[string]float64{"food": 600, "fun": 500},
+			want: []Alert{
+				{Kind: alertEnvelopeOverassigned, Level: alertLevelCritical, Message: "Envelopes hold $100.00 more than your income - release money back to the pool"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := EnvelopeLedger{StartDate: "2026-10-01", Assigned: tt.assigned}
+			report := buildEnvelopeReport(ledger, append([]Transaction{income}, tt.expenses...), nil, envelopesNow)
+
+			if len(report.Alerts) != len(tt.want) {
+				t.Fatalf("alerts = %+v, want %d", report.Alerts, len(tt.want))
+			}
+			for i, alert := range report.Alerts {
+				want := tt.want[i]
+				if alert.Kind != want.Kind || alert.Category != want.Category || alert.Level != want.Level || alert.Message != want.Message {
+					t.Errorf("alert = %s %q %s %q; want %s %q %s %q", alert.Kind, alert.Category, alert.Level, alert.Message, want.Kind, want.Category, want.Level, want.Message)
+				}
+				if alert.ID == "" || alert.PeriodStart != "2026-10-01" || !alert.Timestamp.Equal(envelopesNow) {
+					t.Errorf("alert id, period start, timestamp = %q, %s, %s", alert.ID, alert.PeriodStart, alert.Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvelopeFor(t *testing.T) {
+	assigned := map[string]float64{"food": 300, "food > dining": 100, "fun": 50}
+
+	tests := []struct {
+		category string
+		want     string
+	}{
+		{"Food", "food"},
+		{"Food > Groceries", "food"},
+		{"food>dining", "food > dining"},
+		{"Food > Dining > Coffee", "food > dining"},
+		{"Fun", "fun"},
+		{"Funeral", "funeral"}, // not a subcategory of fun
+		{"Travel > Flights", "travel > flights"},
+	}
+
+	for _, tt := range tests {
+		if got := envelopeFor(tt.category, assigned); got != tt.want {
+			t.Errorf("envelopeFor(%q) = %q, want %q", tt.category, got, tt.want)
+		}
+	}
+}
+
+func TestEnvelopeReportSubcategoriesAndBudgets(t *testing.T) {
+	ledger := EnvelopeLedger{StartDate: "2026-10-01", Assigned: map[string]float64{"food": 400, "food > dining": 100}}
+	transactions := []Transaction{
+		{Category: "Salary", Amount: 500, Date: "2026-10-01", Type: "income"},
+		{Category: "Food > Groceries", Amount: 120, Date: "2026-10-02", Type: "expense"},
+		{Category: "Food > Dining", Amount: 30, Date: "2026-10-03", Type: "expense"},
+		{Category: "Food", Amount: 30, Date: "2026-09-30", Type: "expense"}, // before the ledger
+	}
+	budgets := []Budget{
+		{ID: 7, Category: "Food", Amount: 100, Period: "weekly"},
+		{ID: 8, Category: "Food > Groceries", Amount: 300, Period: "monthly"},
+	}
+
+	report := buildEnvelopeReport(ledger, transactions, budgets, envelopesNow)
+
+	want := []Envelope{
+		{Category: "food", Assigned: 400, Spent: 120, Available: 280, Status: "funded", BudgetID: 7, Budgeted: 442.86}, // 100 * 31/7
+		{Category: "food > dining", Assigned: 100, Spent: 30, Available: 70, Status: "funded"},
+	}
+	if len(report.Envelopes) != len(want) {
+		t.Fatalf("envelopes = %+v, want %+v", report.Envelopes, want)
+	}
+	for i := range want {
+		if report.Envelopes[i] != want[i] {
+			t.Errorf("envelope = %+v, want %+v", report.Envelopes[i], want[i])
+		}
+	}
+	if report.Spent != 150 || report.Unassigned != 0 {
+		t.Errorf("spent, unassigned = %v, %v; want 150, 0", report.Spent, report.Unassigned)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+)
+
+// ErrorCode is a stable, machine-matchable identifier for a failure. Codes
+// are part of the API contract: add new ones, never rename existing ones.
+type ErrorCode string
+
+const (
+	CodeAuthMissing         ErrorCode = "AUTH_MISSING"
+	CodeAuthInvalid         ErrorCode = "AUTH_INVALID"
+	CodeAuthUnavailable     ErrorCode = "AUTH_UNAVAILABLE"
+	CodeUpstreamTimeout     ErrorCode = "UPSTREAM_TIMEOUT"
+	CodeUpstreamUnavailable ErrorCode = "UPSTREAM_UNAVAILABLE"
+	CodeUpstreamBadResponse ErrorCode = "UPSTREAM_BAD_RESPONSE"
+	CodeValidationFailed    ErrorCode = "VALIDATION_FAILED"
+	CodeNotFound            ErrorCode = "NOT_FOUND"
+	CodeConflict            ErrorCode = "CONFLICT"
+	CodeMethodNotAllowed    ErrorCode = "METHOD_NOT_ALLOWED"
+	CodeInternal            ErrorCode = "INTERNAL"
+)
+
+var errorCodeStatus = map[ErrorCode]int{
+	CodeAuthMissing:         http.StatusUnauthorized,
+	CodeAuthInvalid:         http.StatusUnauthorized,
+	CodeAuthUnavailable:     http.StatusServiceUnavailable,
+	CodeUpstreamTimeout:     http.StatusGatewayTimeout,
+	CodeUpstreamUnavailable: http.StatusServiceUnavailable,
+	CodeUpstreamBadResponse: http.StatusBadGateway,
+	CodeValidationFailed:    http.StatusBadRequest,
+	CodeNotFound:            http.StatusNotFound,
+	CodeConflict:            http.StatusConflict,
+	CodeMethodNotAllowed:    http.StatusMethodNotAllowed,
+	CodeInternal:            http.StatusInternalServerError,
+}
+
+// FieldError pinpoints a problem with one input field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is the error envelope returned to clients. Message is safe to
+// show to users; the underlying cause is only logged.
+type APIError struct {
+	Code      ErrorCode    `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	cause     error
+}
+
+func newAPIError(code ErrorCode, message string) *APIError {
+	return &APIError{Code: code, Message: message}
+}
+
+func wrapAPIError(code ErrorCode, message string, cause error) *APIError {
+	return &APIError{Code: code, Message: message, cause: cause}
+}
+
+func (e *APIError) Error() string {
+	if e.cause != nil {
+		return string(e.Code) + ": " + e.Message + ": " + e.cause.Error()
+	}
+	return string(e.Code) + ": " + e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+func (e *APIError) Status() int {
+	if status, ok := errorCodeStatus[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Maps a failed call to an upstream service onto a timeout or unavailable code
+func upstreamCallError(code ErrorCode, message string, err error) *APIError {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return wrapAPIError(CodeUpstreamTimeout, message, err)
+	}
+	return wrapAPIError(code, message, err)
+}
+
+// Reports whether err means an upstream service, rather than the caller, is at fault
+func isUpstreamFailure(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case CodeUpstreamTimeout, CodeUpstreamUnavailable, CodeUpstreamBadResponse:
+		return true
+	}
+	return false
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// Reuses a well-formed X-Request-ID from the caller, otherwise mints one
+func requestIDFor(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); requestIDPattern.MatchString(id) {
+		return id
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Writes err as the standard error envelope. Errors that aren't *APIError are
+// reported as INTERNAL without exposing their text.
+func writeError(w http.ResponseWriter, requestID string, err error) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = wrapAPIError(CodeInternal, "Internal error", err)
+	}
+	if apiErr.cause != nil {
+		log.Printf("budget-analyzer: request %s failed with %s: %v", requestID, apiErr.Code, apiErr.cause)
+	}
+
+	body := *apiErr
+	body.RequestID = requestID
+
+	w.WriteHeader(apiErr.Status())
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  false,
+		"error":    body,
+		"function": "budget-analyzer",
+		"runtime":  "Go",
+	})
+}
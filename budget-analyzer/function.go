@@ -2,53 +2,97 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Budget struct {
-	ID       int     `json:"id"`
-	Category string  `json:"category"`
-	Amount   float64 `json:"amount"`
-	Period   string  `json:"period"` // monthly, weekly, daily
+	ID          int     `json:"id"`
+	Category    string  `json:"category"`
+	Amount      float64 `json:"amount"`
+	Period      string  `json:"period"`                 // monthly, weekly, daily
+	Rollover    bool    `json:"rollover,omitempty"`     // carry surplus/deficit into the next period
+	RolloverCap float64 `json:"rollover_cap,omitempty"` // bound on the carried balance, 0 for none
+
+	// YYYY-MM-DD; carrying starts with the period containing this day. Stored
+	// budgets default it to the day rollover was turned on.
+	RolloverFrom string `json:"rollover_from,omitempty"`
+
+	// Alert thresholds in % of the budget used, 0 for the user's defaults
+	WarningThreshold  float64 `json:"warning_threshold,omitempty"`
+	CriticalThreshold float64 `json:"critical_threshold,omitempty"`
+
+	// Set on generated budgets only: how the amount was derived
+	Suggestion *BudgetSuggestion `json:"suggestion,omitempty"`
+}
+
+type BudgetSuggestion struct {
+	Method           string   `json:"method"`            // median, p75, p90, or an income-based mode
+	MonthlyStatistic float64  `json:"monthly_statistic"` // the chosen statistic of monthly spend
+	Buffer           float64  `json:"buffer,omitempty"`  // multiplier applied on top of the statistic
+	SourceMonths     []string `json:"source_months"`
+	ExcludedMonths   []string `json:"excluded_months,omitempty"` // outlier months left out
+	Bucket           string   `json:"bucket,omitempty"`          // needs, wants, savings for income-based modes
+	IncomeShare      float64  `json:"income_share,omitempty"`    // % of monthly income allocated
+	MonthlyIncome    float64  `json:"monthly_income,omitempty"`  // detected (median) monthly income
 }
 
 type BudgetAnalysis struct {
-	Category       string  `json:"category"`
-	Budgeted       float64 `json:"budgeted"`
-	Spent          float64 `json:"spent"`
-	Remaining      float64 `json:"remaining"`
-	PercentageUsed float64 `json:"percentage_used"`
-	Status         string  `json:"status"` // on_track, warning, over_budget
-	DaysRemaining  int     `json:"days_remaining"`
-	PredictedSpend float64 `json:"predicted_spend"`
-	Recommendation string  `json:"recommendation"`
+	Category          string           `json:"category"`
+	Parent            string           `json:"parent,omitempty"` // nearest budgeted ancestor category
+	Period            string           `json:"period"`
+	PeriodStart       string           `json:"period_start"`
+	PeriodEnd         string           `json:"period_end"`
+	Budgeted          float64          `json:"budgeted"`       // base + carried
+	BaseAmount        float64          `json:"base_amount"`    // the budget itself, pro-rated to the window
+	CarriedAmount     float64          `json:"carried_amount"` // rollover from earlier periods
+	MonthlyEquivalent float64          `json:"monthly_equivalent"`
+	Rollover          bool             `json:"rollover,omitempty"`
+	Spent             float64          `json:"spent"`
+	Remaining         float64          `json:"remaining"`
+	PercentageUsed    float64          `json:"percentage_used"`
+	Status            string           `json:"status"`                       // on_track, warning, critical, over_budget
+	OverspentChildren []string         `json:"overspent_children,omitempty"` // budgeted subcategories over budget
+	DaysRemaining     int              `json:"days_remaining,omitempty"`     // open periods only
+	PredictedSpend    *float64         `json:"predicted_spend,omitempty"`    // open periods only
+	Prediction        *SpendPrediction `json:"prediction,omitempty"`         // open periods only: method, interval and components
+	Pace              *BudgetPace      `json:"pace,omitempty"`               // open periods only
+	Verdict           string           `json:"verdict,omitempty"`            // closed periods only: under_budget, on_budget, over_budget
+	Recommendation    string           `json:"recommendation"`
 }
 
 type OverallBudgetHealth struct {
+	PeriodStart      string           `json:"period_start"`
+	PeriodEnd        string           `json:"period_end"`
+	PeriodClosed     bool             `json:"period_closed"`
 	TotalBudgeted    float64          `json:"total_budgeted"`
 	TotalSpent       float64          `json:"total_spent"`
 	TotalRemaining   float64          `json:"total_remaining"`
 	OverallStatus    string           `json:"overall_status"`
 	BudgetCategories []BudgetAnalysis `json:"budget_categories"`
-	Alerts           []string         `json:"alerts"`
+	Alerts           []Alert          `json:"alerts"`
 	HealthScore      float64          `json:"health_score"`
 	Recommendations  []string         `json:"recommendations"`
 }
 
 type Transaction struct {
-	ID          string  `json:"_id"`
-	UserID      string  `json:"userId"`
-	Description string  `json:"description"`
-	Amount      float64 `json:"amount"`
-	Category    string  `json:"category"`
-	Date        string  `json:"date"`
-	Type        string  `json:"type"`
-	CreatedAt   string  `json:"createdAt"`
+	ID          string   `json:"_id"`
+	UserID      string   `json:"userId"`
+	Description string   `json:"description"`
+	Amount      float64  `json:"amount"`
+	Category    string   `json:"category"`
+	Tags        []string `json:"tags,omitempty"`
+	Date        string   `json:"date"`
+	Type        string   `json:"type"`
+	CreatedAt   string   `json:"createdAt"`
+	UpdatedAt   string   `json:"updatedAt"`
 }
 
 type TransactionAPIResponse struct {
@@ -58,15 +102,118 @@ type TransactionAPIResponse struct {
 	Runtime  string        `json:"runtime"`
 }
 
+type AuthServiceResponse struct {
+	Success bool `json:"success"`
+	User    struct {
+		ID string `json:"_id"`
+	} `json:"user"`
+	Error string `json:"error"`
+}
+
+// Default deployment the function was built against
+const defaultServiceBaseURL = "https://freeserverless.com/invok/cf749b32-a29a-4080-bbd0-87a66a9d1b00"
+
+// Service URLs
+func getAuthServiceURL() string {
+	if url := os.Getenv("AUTH_SERVICE_URL"); url != "" {
+		return url
+	}
+	return defaultServiceBaseURL + "/auth-service"
+}
+
+func getTransactionAPIURL() string {
+	if url := os.Getenv("TRANSACTION_API_URL"); url != "" {
+		return url
+	}
+	return defaultServiceBaseURL + "/transaction-api"
+}
+
+// Verify user authentication, reusing a recent auth-service answer for the same token
+func verifyAuth(authHeader string) (string, error) {
+	if authHeader == "" {
+		return "", newAPIError(CodeAuthMissing, "Authorization header required")
+	}
+
+	key := hashToken(authHeader)
+	if entry, ok := verifiedTokens.get(key); ok {
+		return entry.userID, entry.err
+	}
+
+	now := time.Now()
+	userID, err := verifyAuthRemote(authHeader)
+
+	var rejected *authRejectedError
+	if err == nil {
+		verifiedTokens.put(key, authCacheEntry{userID: userID, expiresAt: verifiedExpiry(authHeader, now)})
+	} else if errors.As(err, &rejected) {
+		verifiedTokens.put(key, authCacheEntry{err: err, expiresAt: now.Add(getAuthCacheNegativeTTL())})
+	}
+
+	return userID, err
+}
+
+// Verify user authentication through auth-service
+func verifyAuthRemote(authHeader string) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest("GET", getAuthServiceURL()+"?action=verify", nil)
+	if err != nil {
+		return "", wrapAPIError(CodeInternal, "Internal error", fmt.Errorf("failed to create auth request: %w", err))
+	}
+
+	req.Header.Set("Authorization", authHeader)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", upstreamCallError(CodeAuthUnavailable, "Authentication service is unavailable", err)
+	}
+	defer resp.Body.Close()
+
+	// Only a 401/403, or a 200 that says the token isn't valid, is a
+	// rejection; anything else is auth-service failing and mustn't lock the
+	// user out
+	var authResp AuthServiceResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&authResp)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return "", wrapAPIError(CodeAuthInvalid, "Invalid or expired token", &authRejectedError{reason: authResp.Error})
+	case resp.StatusCode != http.StatusOK:
+		return "", wrapAPIError(CodeAuthUnavailable, "Authentication service is unavailable", fmt.Errorf("auth service returned status %d", resp.StatusCode))
+	case decodeErr != nil:
+		return "", wrapAPIError(CodeAuthUnavailable, "Authentication service is unavailable", fmt.Errorf("failed to decode auth response: %w", decodeErr))
+	case !authResp.Success:
+		return "", wrapAPIError(CodeAuthInvalid, "Invalid or expired token", &authRejectedError{reason: authResp.Error})
+	case authResp.User.ID == "":
+		return "", wrapAPIError(CodeAuthUnavailable, "Authentication service is unavailable", errors.New("auth response has no user id"))
+	}
+
+	return authResp.User.ID, nil
+}
+
+// Extracts the bearer token from the request and verifies it with auth-service
+func requireAuth(r *http.Request) (userID string, authToken string, err error) {
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		authToken = strings.TrimPrefix(authHeader, "Bearer ")
+	}
+
+	if authToken == "" {
+		return "", "", newAPIError(CodeAuthMissing, "Authorization token required")
+	}
+
+	userID, err = verifyAuth(authHeader)
+	if err != nil {
+		return "", "", err
+	}
+	return userID, authToken, nil
+}
+
 // Fetch transactions from transaction-api
 func fetchTransactions(authToken string) ([]Transaction, error) {
-	// Get the base URL from environment or use default
-	baseURL := "https://freeserverless.com/invok/cf749b32-a29a-4080-bbd0-87a66a9d1b00"
-
 	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", baseURL+"/transaction-api", nil)
+	req, err := http.NewRequest("GET", getTransactionAPIURL(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, wrapAPIError(CodeInternal, "Internal error", fmt.Errorf("failed to create request: %w", err))
 	}
 
 	if authToken != "" {
@@ -76,180 +223,279 @@ func fetchTransactions(authToken string) ([]Transaction, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch transactions: %v", err)
+		return nil, upstreamCallError(CodeUpstreamUnavailable, "Transaction service is unavailable", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("unauthorized - invalid or missing auth token")
+		return nil, newAPIError(CodeAuthInvalid, "Invalid or expired token")
+	}
+
+	if resp.StatusCode >= 500 {
+		return nil, wrapAPIError(CodeUpstreamUnavailable, "Transaction service is unavailable", fmt.Errorf("transaction API returned status %d", resp.StatusCode))
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("transaction API returned status %d", resp.StatusCode)
+		return nil, wrapAPIError(CodeUpstreamBadResponse, "Transaction service returned an invalid response", fmt.Errorf("transaction API returned status %d", resp.StatusCode))
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+		return nil, upstreamCallError(CodeUpstreamUnavailable, "Transaction service is unavailable", fmt.Errorf("failed to read response: %w", err))
 	}
 
 	var apiResponse TransactionAPIResponse
 	if err := json.Unmarshal(body, &apiResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+		return nil, wrapAPIError(CodeUpstreamBadResponse, "Transaction service returned an invalid response", fmt.Errorf("failed to parse response: %w", err))
 	}
 
 	if !apiResponse.Success {
-		return nil, fmt.Errorf("transaction API returned unsuccessful response")
+		return nil, wrapAPIError(CodeUpstreamBadResponse, "Transaction service returned an invalid response", fmt.Errorf("transaction API returned unsuccessful response"))
 	}
 
 	return apiResponse.Data, nil
 }
 
-// Generate realistic budgets based on spending patterns
-func generateBudgetsFromSpending(transactions []Transaction) []Budget {
-	spendingByCategory := make(map[string]float64)
+// How generated budgets are derived from history
+type generationOptions struct {
+	Mode           string             // spending, 50-30-20, zero-based, custom
+	Method         string             // median, p75, p90 for spending mode
+	Split          map[string]float64 // bucket -> % of income for custom mode
+	Buckets        map[string]string  // the user's category -> bucket overrides
+	LookbackMonths int
+	Now            time.Time
+}
 
-	// Calculate total spending per category
-	for _, transaction := range transactions {
-		if transaction.Type == "expense" {
-			spendingByCategory[transaction.Category] += transaction.Amount
+var generationPercentiles = map[string]float64{"median": 50, "p75": 75, "p90": 90}
+
+// Defaults from BUDGET_GENERATION_MODE, BUDGET_SUGGESTION_METHOD and
+// BUDGET_LOOKBACK_MONTHS, overridable with the mode, split, method and
+// lookback_months query parameters
+func generationOptionsFromQuery(r *http.Request) (generationOptions, error) {
+	opts := generationOptions{Mode: "spending", Method: "median", LookbackMonths: 6, Now: time.Now()}
+	if mode := os.Getenv("BUDGET_GENERATION_MODE"); validGenerationModes[mode] && mode != "custom" {
+		opts.Mode = mode
+	}
+	if method := os.Getenv("BUDGET_SUGGESTION_METHOD"); generationPercentiles[method] > 0 {
+		opts.Method = method
+	}
+	if months, err := strconv.Atoi(os.Getenv("BUDGET_LOOKBACK_MONTHS")); err == nil && months >= 1 && months <= 36 {
+		opts.LookbackMonths = months
+	}
+
+	var details []FieldError
+	if mode := r.URL.Query().Get("mode"); mode != "" {
+		if !validGenerationModes[mode] {
+			details = append(details, FieldError{Field: "mode", Message: "must be one of spending, 50-30-20, zero-based, custom"})
+		}
+		opts.Mode = mode
+	}
+	if split := r.URL.Query().Get("split"); split != "" {
+		if opts.Mode != "custom" {
+			details = append(details, FieldError{Field: "split", Message: "is only allowed with mode=custom"})
+		} else {
+			parsed, splitDetails := parseBucketSplit(split)
+			details = append(details, splitDetails...)
+			opts.Split = parsed
+		}
+	} else if opts.Mode == "custom" {
+		details = append(details, FieldError{Field: "split", Message: "is required with mode=custom"})
+	}
+	if method := r.URL.Query().Get("method"); method != "" {
+		if generationPercentiles[method] == 0 {
+			details = append(details, FieldError{Field: "method", Message: "must be one of median, p75, p90"})
 		}
+		opts.Method = method
+	}
+	if value := r.URL.Query().Get("lookback_months"); value != "" {
+		months, err := strconv.Atoi(value)
+		if err != nil || months < 1 || months > 36 {
+			details = append(details, FieldError{Field: "lookback_months", Message: "must be a whole number between 1 and 36"})
+		}
+		opts.LookbackMonths = months
+	}
+	if len(details) > 0 {
+		return opts, validationError(details)
 	}
 
-	var budgets []Budget
-	budgetMultiplier := 1.3 // Set budgets 30% higher than current spending
-
-	// Create budgets for each category with realistic amounts
-	for category, totalSpent := range spendingByCategory {
-		if totalSpent > 0 {
-			budgetAmount := totalSpent * budgetMultiplier
-
-			// Apply category-specific adjustments for realistic budgets
-			switch strings.ToLower(category) {
-			case "housing":
-				budgetAmount = totalSpent * 1.05 // Housing is usually fixed
-			case "utilities":
-				budgetAmount = totalSpent * 1.15 // Utilities have some variation
-			case "food":
-				budgetAmount = totalSpent * 1.25 // Food can be optimized
-			case "transportation":
-				budgetAmount = totalSpent * 1.20 // Transportation varies
-			case "entertainment":
-				budgetAmount = totalSpent * 1.50 // Entertainment is flexible
-			case "shopping":
-				budgetAmount = totalSpent * 1.40 // Shopping can be reduced
-			case "healthcare":
-				budgetAmount = totalSpent * 1.10 // Healthcare is mostly needed
-			case "education":
-				budgetAmount = totalSpent * 1.20 // Education investment
-			default:
-				budgetAmount = totalSpent * 1.30 // Default 30% buffer
-			}
+	return opts, nil
+}
 
-			budget := Budget{
-				ID:       len(budgets) + 1,
-				Category: category,
-				Amount:   math.Round(budgetAmount*100) / 100, // Round to 2 decimal places
-				Period:   "monthly",
-			}
-			budgets = append(budgets, budget)
+func (o generationOptions) variant() string {
+	variant := fmt.Sprintf("%s|%s|%d", o.Mode, o.Method, o.LookbackMonths)
+	for _, bucket := range budgetBuckets {
+		if share, ok := o.Split[bucket]; ok {
+			variant += fmt.Sprintf("|%s:%g", bucket, share)
 		}
 	}
+	return variant
+}
 
-	return budgets
+// Category-specific headroom applied to a typical (median) month
+func categoryBuffer(category string) float64 {
+	switch strings.ToLower(category) {
+	case "housing":
+		return 1.05 // Housing is usually fixed
+	case "utilities":
+		return 1.15 // Utilities have some variation
+	case "food":
+		return 1.25 // Food can be optimized
+	case "transportation":
+		return 1.20 // Transportation varies
+	case "entertainment":
+		return 1.50 // Entertainment is flexible
+	case "shopping":
+		return 1.40 // Shopping can be reduced
+	case "healthcare":
+		return 1.10 // Healthcare is mostly needed
+	case "education":
+		return 1.20 // Education investment
+	default:
+		return 1.30 // Default 30% buffer
+	}
 }
 
-// Calculate days passed and remaining in current month
-func calculateMonthProgress() (daysPassed int, daysRemaining int) {
-	now := time.Now()
-	year, month, _ := now.Date()
+// Generate realistic monthly budgets from per-month spending: the median (or
+// a higher percentile) of each category's monthly spend over the lookback,
+// ignoring outlier months. Median suggestions get the category buffer;
+// percentile suggestions already include headroom and are used as-is.
+func generateBudgetsFromSpending(transactions []Transaction, opts generationOptions) []Budget {
+	history := buildMonthlyHistory(transactions, sourceMonths(transactions, opts.Now, opts.LookbackMonths))
 
-	// First day of current month
-	firstDay := time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+	var budgets []Budget
+	for _, category := range history.categories() {
+		statistic, sourceKeys, excludedKeys := categoryStatistic(history, category, generationPercentiles[opts.Method])
+		if statistic <= 0 {
+			continue
+		}
 
-	// First day of next month
-	nextMonth := firstDay.AddDate(0, 1, 0)
+		buffer := 1.0
+		if opts.Method == "median" {
+			buffer = categoryBuffer(category)
+		}
 
-	// Days passed since start of month
-	daysPassed = int(now.Sub(firstDay).Hours() / 24)
+		budgets = append(budgets, Budget{
+			ID:       len(budgets) + 1,
+			Category: category,
+			Amount:   math.Round(statistic*buffer*100) / 100, // Round to 2 decimal places
+			Period:   "monthly",
+			Suggestion: &BudgetSuggestion{
+				Method:           opts.Method,
+				MonthlyStatistic: math.Round(statistic*100) / 100,
+				Buffer:           buffer,
+				SourceMonths:     sourceKeys,
+				ExcludedMonths:   excludedKeys,
+			},
+		})
+	}
 
-	// Total days in month
-	totalDays := int(nextMonth.Sub(firstDay).Hours() / 24)
+	return budgets
+}
 
-	// Days remaining
-	daysRemaining = totalDays - daysPassed
+// An expense with its date parsed, ready for window filtering
+type expenseEntry struct {
+	at          time.Time
+	path        []string // category and its ancestors
+	amount      float64
+	description string
+}
 
-	if daysPassed <= 0 {
-		daysPassed = 1 // Minimum 1 day passed
-	}
-	if daysRemaining <= 0 {
-		daysRemaining = 1 // Minimum 1 day remaining
+func collectExpenses(transactions []Transaction) []expenseEntry {
+	var expenses []expenseEntry
+	for _, transaction := range transactions {
+		if transaction.Type != "expense" {
+			continue
+		}
+		transactionTime, err := parseTransactionDate(transaction.Date)
+		if err != nil {
+			continue // Skip invalid dates
+		}
+		expenses = append(expenses, expenseEntry{at: transactionTime, path: categoryPath(transaction.Category), amount: transaction.Amount, description: transaction.Description})
 	}
+	return expenses
+}
 
-	return daysPassed, daysRemaining
+// Spending in a category and all of its subcategories
+func spentInWindow(expenses []expenseEntry, category string, window budgetWindow) float64 {
+	category = canonicalCategory(category)
+	spent := 0.0
+	for _, expense := range expenses {
+		if window.contains(expense.at) && categoryWithin(expense.path, category) {
+			spent += expense.amount
+		}
+	}
+	return spent
 }
 
 // High-performance budget analysis engine
-func analyzeBudgets(budgets []Budget, transactions []Transaction) OverallBudgetHealth {
-	budgetMap := make(map[string]Budget)
-	spendingMap := make(map[string]float64)
-
-	// Create budget lookup map
+func analyzeBudgets(budgets []Budget, transactions []Transaction, opts analysisOptions) OverallBudgetHealth {
+	// Last budget wins for a repeated category, in the order given
+	var ordered []Budget
+	budgetIndex := make(map[string]int)
 	for _, budget := range budgets {
-		budgetMap[budget.Category] = budget
+		key := strings.ToLower(canonicalCategory(budget.Category))
+		if i, ok := budgetIndex[key]; ok {
+			ordered[i] = budget
+			continue
+		}
+		budgetIndex[key] = len(ordered)
+		ordered = append(ordered, budget)
 	}
 
-	// Calculate spending by category for current month only
-	currentTime := time.Now()
-	currentMonth := currentTime.Month()
-	currentYear := currentTime.Year()
-
-	for _, transaction := range transactions {
-		if transaction.Type == "expense" {
-			// Parse transaction date
-			transactionTime, err := time.Parse("2006-01-02T15:04:05.000Z", transaction.Date)
-			if err != nil {
-				// Try alternative date format
-				transactionTime, err = time.Parse("2006-01-02", transaction.Date)
-				if err != nil {
-					continue // Skip invalid dates
-				}
-			}
+	expenses := collectExpenses(transactions)
 
-			// Only include transactions from current month
-			if transactionTime.Month() == currentMonth && transactionTime.Year() == currentYear {
-				spendingMap[transaction.Category] += transaction.Amount
-			}
-		}
+	// Totals cover the requested range, or the current month
+	totalsWindow := periodWindow("monthly", opts.Now, opts.WeekStart)
+	if opts.Range != nil {
+		totalsWindow = *opts.Range
 	}
 
 	var analyses []BudgetAnalysis
-	var totalBudgeted, totalSpent float64
-	var alerts []string
+	var totalsBudgets, totalsSpent []float64
+	var alerts []Alert
+
+	// Analyze each budget category over its own period, or the requested range
+	for _, budget := range ordered {
+		category := budget.Category
+		period := normalizePeriod(budget.Period)
+		window := periodWindow(period, opts.Now, opts.WeekStart)
+		baseAmount := budget.Amount
+		if opts.Range != nil {
+			window = *opts.Range
+			baseAmount = scaleToWindow(budget.Amount, period, window, opts.WeekStart)
+		}
+		closed := opts.isClosed(window)
 
-	daysPassed, daysRemaining := calculateMonthProgress()
+		// Rollover only applies to windows that are one of the budget's own periods
+		carried := 0.0
+		if periodWindow(period, window.Start, opts.WeekStart) == window {
+			carried = rolloverCarry(budget, expenses, window, opts.WeekStart)
+		}
+		budgeted := math.Max(baseAmount+carried, 0)
 
-	// Analyze each budget category
-	for category, budget := range budgetMap {
-		spent := spendingMap[category]
-		remaining := budget.Amount - spent
+		spent := spentInWindow(expenses, category, window)
+		remaining := budgeted - spent
 		percentageUsed := 0.0
-		if budget.Amount > 0 {
-			percentageUsed = (spent / budget.Amount) * 100
+		if budgeted > 0 {
+			percentageUsed = (spent / budgeted) * 100
+		} else if spent > 0 {
+			percentageUsed = 100 // Carried deficit has used up the whole allowance
 		}
 
-		// Determine status
+		// Determine status against the budget's own thresholds, or the defaults
+		warningAt, criticalAt := budgetThresholds(budget, opts.Alerts)
 		var status string
 		var recommendation string
 
 		if percentageUsed >= 100 {
 			status = "over_budget"
 			recommendation = "⚠️ Over budget! Reduce spending immediately"
-			alerts = append(alerts, category+" is over budget")
-		} else if percentageUsed >= 80 {
+		} else if percentageUsed >= criticalAt {
+			status = "critical"
+			recommendation = "🔴 Almost out of budget - hold off on non-essential spending"
+		} else if percentageUsed >= warningAt {
 			status = "warning"
 			recommendation = "🔶 Approaching budget limit - spend carefully"
-			alerts = append(alerts, category+" is approaching budget limit")
 		} else if percentageUsed >= 60 {
 			status = "on_track"
 			recommendation = "👍 On track - maintain current spending"
@@ -258,30 +504,76 @@ func analyzeBudgets(budgets []Budget, transactions []Transaction) OverallBudgetH
 			recommendation = "💚 Well under budget - good job!"
 		}
 
-		// Predictive spending analysis
-		spendingRate := 0.0
-		if daysPassed > 0 {
-			spendingRate = spent / float64(daysPassed)
+		// Mixed periods are totalled on a common basis: budgets are pro-rated
+		// to the current month (or the requested range) and compared with
+		// spending over that same window. A weekly or daily carry belongs to
+		// just one of the month's periods, so only a monthly carry is counted.
+		totalsBudget := monthlyEquivalent(budget.Amount, period, opts.Now, opts.WeekStart)
+		if period == "monthly" {
+			totalsBudget += carried
+		}
+		if opts.Range != nil {
+			totalsBudget = budgeted
 		}
-
-		totalDaysInMonth := daysPassed + daysRemaining
-		predictedSpend := spendingRate * float64(totalDaysInMonth)
 
 		analysis := BudgetAnalysis{
-			Category:       category,
-			Budgeted:       budget.Amount,
-			Spent:          spent,
-			Remaining:      remaining,
-			PercentageUsed: math.Round(percentageUsed*100) / 100,
-			Status:         status,
-			DaysRemaining:  daysRemaining,
-			PredictedSpend: math.Round(predictedSpend*100) / 100,
-			Recommendation: recommendation,
+			Category:          category,
+			Period:            period,
+			PeriodStart:       window.Start.Format("2006-01-02"),
+			PeriodEnd:         window.End.AddDate(0, 0, -1).Format("2006-01-02"),
+			Budgeted:          math.Round(budgeted*100) / 100,
+			BaseAmount:        math.Round(baseAmount*100) / 100,
+			CarriedAmount:     math.Round(carried*100) / 100,
+			Rollover:          budget.Rollover,
+			MonthlyEquivalent: math.Round(monthlyEquivalent(budget.Amount, period, window.Start, opts.WeekStart)*100) / 100,
+			Spent:             spent,
+			Remaining:         math.Round(remaining*100) / 100,
+			PercentageUsed:    math.Round(percentageUsed*100) / 100,
+			Status:            status,
+			Recommendation:    recommendation,
+		}
+
+		if closed {
+			// A finished period gets a verdict instead of predictions
+			analysis.Verdict, analysis.Recommendation = closedPeriodVerdict(budgeted, spent)
+		} else {
+			// Predictive spending analysis
+			_, daysRemaining := calculatePeriodProgress(window, opts.Now)
+			daysElapsed := elapsedDays(window, opts.Now)
+			prediction := predictSpend(category, expenses, spent, budgeted, window, daysElapsed)
+
+			predictedSpend := math.Round(prediction.predicted*100) / 100
+			analysis.DaysRemaining = daysRemaining
+			analysis.PredictedSpend = &predictedSpend
+			analysis.Prediction = &prediction
+
+			pace := budgetPace(budgeted, spent, prediction, window, daysElapsed, opts.Now)
+			analysis.Pace = &pace
+		}
+
+		if !closed {
+			if alert, ok := budgetThresholdAlert(analysis, warningAt, criticalAt, opts.Now); ok {
+				alerts = append(alerts, alert)
+			}
+			if alert, ok := paceAlert(analysis, opts.Now); ok {
+				alerts = append(alerts, alert)
+			}
 		}
 
 		analyses = append(analyses, analysis)
-		totalBudgeted += budget.Amount
-		totalSpent += spent
+		totalsBudgets = append(totalsBudgets, totalsBudget)
+		totalsSpent = append(totalsSpent, spentInWindow(expenses, category, totalsWindow))
+	}
+
+	// A subcategory's spending is already part of its parent's, so only
+	// top-level budgets count towards the totals
+	alerts = append(alerts, linkBudgetHierarchy(analyses, opts.Now)...)
+	var totalBudgeted, totalSpent float64
+	for i, analysis := range analyses {
+		if analysis.Parent == "" {
+			totalBudgeted += totalsBudgets[i]
+			totalSpent += totalsSpent[i]
+		}
 	}
 
 	totalRemaining := totalBudgeted - totalSpent
@@ -291,19 +583,29 @@ func analyzeBudgets(budgets []Budget, transactions []Transaction) OverallBudgetH
 	}
 
 	var overallStatus string
-	if overallPercentage >= 90 {
+	if overallPercentage >= opts.Alerts.OverallCriticalThreshold {
 		overallStatus = "critical"
-	} else if overallPercentage >= 75 {
+	} else if overallPercentage >= opts.Alerts.OverallWarningThreshold {
 		overallStatus = "warning"
 	} else {
 		overallStatus = "healthy"
 	}
 
+	if overallStatus != "healthy" && !opts.isClosed(totalsWindow) {
+		alerts = append(alerts, overallThresholdAlert(overallStatus, overallPercentage, totalBudgeted, totalSpent, totalsWindow, opts))
+	}
+
+	// Custom rules look back from today, so only apply to the current period
+	if !opts.isClosed(totalsWindow) {
+		alerts = append(alerts, evaluateAlertRules(opts.Rules, transactions, opts.Now)...)
+	}
+
 	// Calculate health score (0-100)
 	healthScore := calculateBudgetHealthScore(analyses)
 
 	// Generate recommendations
 	recommendations := generateBudgetRecommendations(OverallBudgetHealth{
+		PeriodClosed:     opts.isClosed(totalsWindow),
 		TotalBudgeted:    totalBudgeted,
 		TotalSpent:       totalSpent,
 		TotalRemaining:   totalRemaining,
@@ -314,6 +616,9 @@ func analyzeBudgets(budgets []Budget, transactions []Transaction) OverallBudgetH
 	})
 
 	return OverallBudgetHealth{
+		PeriodStart:      totalsWindow.Start.Format("2006-01-02"),
+		PeriodEnd:        totalsWindow.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		PeriodClosed:     opts.isClosed(totalsWindow),
 		TotalBudgeted:    math.Round(totalBudgeted*100) / 100,
 		TotalSpent:       math.Round(totalSpent*100) / 100,
 		TotalRemaining:   math.Round(totalRemaining*100) / 100,
@@ -325,6 +630,19 @@ func analyzeBudgets(budgets []Budget, transactions []Transaction) OverallBudgetH
 	}
 }
 
+// Final verdict for a budget whose period has ended. Within 10% under the
+// budget counts as on budget.
+func closedPeriodVerdict(budgeted, spent float64) (verdict string, recommendation string) {
+	switch {
+	case spent > budgeted:
+		return "over_budget", fmt.Sprintf("❌ Finished %.2f over budget", spent-budgeted)
+	case spent >= budgeted*0.9:
+		return "on_budget", "👍 Finished right on budget"
+	default:
+		return "under_budget", fmt.Sprintf("💚 Finished under budget with %.2f to spare", budgeted-spent)
+	}
+}
+
 func calculateBudgetHealthScore(analyses []BudgetAnalysis) float64 {
 	if len(analyses) == 0 {
 		return 50 // Neutral score when no data
@@ -334,16 +652,18 @@ func calculateBudgetHealthScore(analyses []BudgetAnalysis) float64 {
 	for _, analysis := range analyses {
 		categoryScore := 100.0
 
-		// Deduct points based on budget usage
-		if analysis.PercentageUsed >= 100 {
+		// Deduct points based on the status the budget's own thresholds
+		// gave it, then on usage
+		switch {
+		case analysis.Status == "over_budget":
 			categoryScore = 0 // Over budget = 0 points
-		} else if analysis.PercentageUsed >= 90 {
+		case analysis.Status == "critical":
 			categoryScore = 20
-		} else if analysis.PercentageUsed >= 80 {
+		case analysis.Status == "warning":
 			categoryScore = 50
-		} else if analysis.PercentageUsed >= 70 {
+		case analysis.PercentageUsed >= 70:
 			categoryScore = 75
-		} else if analysis.PercentageUsed >= 50 {
+		case analysis.PercentageUsed >= 50:
 			categoryScore = 90
 		}
 		// else stays at 100
@@ -368,7 +688,9 @@ func generateBudgetRecommendations(health OverallBudgetHealth) []string {
 		recommendations = append(recommendations, "🎯 Focus on reducing spending in over-budget categories")
 	}
 
-	if health.OverallStatus == "critical" {
+	if health.OverallStatus == "critical" && health.PeriodClosed {
+		recommendations = append(recommendations, "📅 Review what drove spending in this period before the next one")
+	} else if health.OverallStatus == "critical" {
 		recommendations = append(recommendations, "🚨 Critical: Review all expenses immediately")
 		recommendations = append(recommendations, "✂️ Cut non-essential spending this month")
 	}
@@ -379,9 +701,13 @@ func generateBudgetRecommendations(health OverallBudgetHealth) []string {
 
 	// Add specific recommendations based on spending patterns
 	overBudgetCategories := []string{}
+	criticalCategories := []string{}
 	for _, category := range health.BudgetCategories {
-		if category.Status == "over_budget" {
+		switch category.Status {
+		case "over_budget":
 			overBudgetCategories = append(overBudgetCategories, category.Category)
+		case "critical":
+			criticalCategories = append(criticalCategories, category.Category)
 		}
 	}
 
@@ -389,61 +715,187 @@ func generateBudgetRecommendations(health OverallBudgetHealth) []string {
 		recommendations = append(recommendations,
 			fmt.Sprintf("🎯 Focus on reducing: %s", strings.Join(overBudgetCategories, ", ")))
 	}
+	if len(criticalCategories) > 0 {
+		recommendations = append(recommendations,
+			fmt.Sprintf("🛑 Close to the limit, hold off on spending in: %s", strings.Join(criticalCategories, ", ")))
+	}
 
 	return recommendations
 }
 
 // High-performance budget analysis endpoint
 func BudgetAnalyzerHandler(w http.ResponseWriter, r *http.Request) {
+	requestID := requestIDFor(r)
+
 	// Enable CORS
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match, X-Request-ID")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Request-ID", requestID)
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	if r.Method == "POST" && r.URL.Query().Get("action") == "invalidate" {
+		handleInvalidate(w, r, requestID)
+		return
+	}
+
+	if r.Method == "GET" && r.URL.Query().Get("action") == "report" {
+		handleReport(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "budgets" {
+		handleBudgets(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "bucket-mapping" {
+		handleBucketMapping(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "alert-settings" {
+		handleAlertSettings(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "envelopes" {
+		handleEnvelopes(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "rules" {
+		handleAlertRules(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "alerts" {
+		handleAlerts(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "webhooks" {
+		handleWebhooks(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "webhook-deliveries" {
+		handleWebhookDeliveries(w, r, requestID)
+		return
+	}
+
 	if r.Method == "GET" {
-		// Extract auth token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		authToken := ""
-		if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
-			authToken = strings.TrimPrefix(authHeader, "Bearer ")
+		userID, authToken, err := requireAuth(r)
+		if err != nil {
+			writeError(w, requestID, err)
+			return
 		}
 
-		if authToken == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success":  false,
-				"error":    "Authorization token required",
-				"function": "budget-analyzer",
-				"runtime":  "Go",
-			})
+		opts, err := analysisOptionsFromQuery(r)
+		if err != nil {
+			writeError(w, requestID, err)
+			return
+		}
+		if opts, err = withUserAlertSettings(opts, userID); err != nil {
+			writeError(w, requestID, err)
+			return
+		}
+		genOpts, err := generationOptionsFromQuery(r)
+		if err != nil {
+			writeError(w, requestID, err)
+			return
+		}
+		allAlerts, err := alertVisibilityFromQuery(r)
+		if err != nil {
+			writeError(w, requestID, err)
+			return
+		}
+		alertStates, err := loadAlertStates(userID)
+		if err != nil {
+			writeError(w, requestID, err)
 			return
 		}
 
 		// Fetch real transactions from transaction-api
 		transactions, err := fetchTransactions(authToken)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success":  false,
-				"error":    fmt.Sprintf("Failed to fetch transactions: %v", err),
-				"function": "budget-analyzer",
-				"runtime":  "Go",
-			})
+			// Stale-while-error: keep the dashboard populated with the last
+			// good result, which only ever covers the current period
+			if isUpstreamFailure(err) && opts.Range == nil {
+				if lastGood, ok := loadLastGood(userID, lastGoodView(opts, genOpts)); ok {
+					lastGood.Analysis.Alerts = visibleAlerts(lastGood.Analysis.Alerts, alertStates, opts.Now, allAlerts)
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"success":           true,
+						"data":              lastGood.Analysis,
+						"budgets":           lastGood.Budgets,
+						"transaction_count": lastGood.TransactionCount,
+						"computed_at":       lastGood.ComputedAt.Unix(),
+						"stale":             true,
+						"stale_age_seconds": int64(time.Since(lastGood.ComputedAt).Seconds()),
+						"function":          "budget-analyzer",
+						"runtime":           "Go",
+					})
+					return
+				}
+			}
+
+			writeError(w, requestID, err)
 			return
 		}
 
-		// Generate realistic budgets based on spending patterns
-		budgets := generateBudgetsFromSpending(transactions)
+		// Use the user's own budgets, or generate realistic ones from spending patterns
+		budgets, budgetSource, err := budgetsForUser(userID, transactions, genOpts)
+		if err != nil {
+			writeError(w, requestID, err)
+			return
+		}
 
-		// Perform budget analysis
+		// Perform budget analysis, reusing the cached result while the inputs are unchanged
+		etag := analysisETag(transactions, budgets, opts.variant()+"|"+genOpts.variant())
 		startTime := time.Now()
-		analysis := analyzeBudgets(budgets, transactions)
+		cached, hit := userAnalyses.get(userID)
+		hit = hit && cached.etag == etag
+		analysis := cached.analysis
+		if hit {
+			budgets = cached.budgets
+		} else {
+			analysis = analyzeBudgets(budgets, transactions, opts)
+			computedAt := time.Now()
+			userAnalyses.put(userID, cachedAnalysis{etag: etag, analysis: analysis, budgets: budgets, computedAt: computedAt})
+			if opts.Range == nil {
+				saveLastGood(userID, LastGoodAnalysis{Analysis: analysis, Budgets: budgets, TransactionCount: len(transactions), ComputedAt: computedAt, View: lastGoodView(opts, genOpts)})
+			}
+		}
+
+		// Alerts of the current period feed the alert store; the response
+		// shows each with its state, hiding acknowledged and snoozed ones.
+		// Their webhooks are claimed on every refresh, cached or not, so a
+		// failed delivery gets another round once its retry delay is up.
+		if opts.Range == nil {
+			if alertStates, err = trackAlerts(userID, analysis.Alerts, alertTrackingVariant(opts, budgetSource, genOpts), opts.Now); err != nil {
+				writeError(w, requestID, err)
+				return
+			}
+			notifyAlertWebhooks(userID, visibleAlerts(analysis.Alerts, alertStates, opts.Now, false))
+		}
+
+		// Conditional request: nothing to send if the client already has this
+		// version, alert states included now that they are up to date
+		responseETag := etagWithVariant(etag, fmt.Sprintf("%s|%t", alertStates.variant(opts.Now), allAlerts))
+		w.Header().Set("ETag", responseETag)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if etagMatches(r, responseETag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		analysis.Alerts = visibleAlerts(analysis.Alerts, alertStates, opts.Now, allAlerts)
 		processingTime := time.Since(startTime).Milliseconds()
 
 		w.WriteHeader(http.StatusOK)
@@ -451,9 +903,12 @@ func BudgetAnalyzerHandler(w http.ResponseWriter, r *http.Request) {
 			"success":            true,
 			"data":               analysis,
 			"budgets":            budgets,
+			"budget_source":      budgetSource,
 			"transaction_count":  len(transactions),
 			"computed_at":        time.Now().Unix(),
 			"processing_time_ms": processingTime,
+			"cached":             hit,
+			"stale":              false,
 			"function":           "budget-analyzer",
 			"runtime":            "Go",
 		})
@@ -467,38 +922,87 @@ func BudgetAnalyzerHandler(w http.ResponseWriter, r *http.Request) {
 			authToken = strings.TrimPrefix(authHeader, "Bearer ")
 		}
 
-		var requestData struct {
-			Budgets      []Budget      `json:"budgets"`
-			Transactions []Transaction `json:"transactions"`
+		// source=payload (default) analyzes the posted data as-is;
+		// source=api analyzes the caller's stored transactions
+		source := r.URL.Query().Get("source")
+		if source == "" {
+			source = "payload"
+		}
+		if source != "payload" && source != "api" {
+			writeError(w, requestID, validationError([]FieldError{{Field: "source", Message: "must be one of payload, api"}}))
+			return
+		}
+
+		opts, err := analysisOptionsFromQuery(r)
+		if err != nil {
+			writeError(w, requestID, err)
+			return
+		}
+		genOpts, err := generationOptionsFromQuery(r)
+		if err != nil {
+			writeError(w, requestID, err)
+			return
+		}
+
+		var requestData budgetRequest
+		hasBody, err := decodeJSONBodyLimit(w, r, &requestData, maxRequestBodyBytes)
+		if err != nil {
+			writeError(w, requestID, err)
+			return
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-			// If no custom data provided, fetch from transaction-api
+		var details []FieldError
+		if source == "payload" {
+			if !hasBody {
+				details = append(details, FieldError{Field: "body", Message: "is required when source=payload"})
+			} else if len(requestData.Budgets) == 0 {
+				details = append(details, FieldError{Field: "budgets", Message: "must contain at least one budget when source=payload"})
+			}
+			details = append(details, validateTransactions(requestData.Transactions)...)
+		} else {
 			if authToken == "" {
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"success": false,
-					"error":   "Invalid request data and no auth token provided",
-				})
+				writeError(w, requestID, newAPIError(CodeAuthMissing, "Authorization token required when source=api"))
 				return
 			}
+			if requestData.Transactions != nil {
+				details = append(details, FieldError{Field: "transactions", Message: "must be omitted when source=api"})
+			}
+		}
+		details = append(details, validateBudgets(requestData.Budgets)...)
 
+		if len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+
+		if source == "api" {
+			userID, err := verifyAuth(authHeader)
+			if err != nil {
+				writeError(w, requestID, err)
+				return
+			}
+			if opts, err = withUserAlertSettings(opts, userID); err != nil {
+				writeError(w, requestID, err)
+				return
+			}
 			transactions, err := fetchTransactions(authToken)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"success": false,
-					"error":   fmt.Sprintf("Failed to fetch transactions: %v", err),
-				})
+				writeError(w, requestID, err)
 				return
 			}
 
-			requestData.Budgets = generateBudgetsFromSpending(transactions)
+			if len(requestData.Budgets) == 0 {
+				requestData.Budgets, _, err = budgetsForUser(userID, transactions, genOpts)
+				if err != nil {
+					writeError(w, requestID, err)
+					return
+				}
+			}
 			requestData.Transactions = transactions
 		}
 
 		startTime := time.Now()
-		analysis := analyzeBudgets(requestData.Budgets, requestData.Transactions)
+		analysis := analyzeBudgets(requestData.Budgets, requestData.Transactions, opts)
 		processingTime := time.Since(startTime).Milliseconds()
 
 		w.WriteHeader(http.StatusOK)
@@ -514,9 +1018,25 @@ func BudgetAnalyzerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusMethodNotAllowed)
+	writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+}
+
+// Drop the caller's cached analysis, e.g. after transaction-api writes
+func handleInvalidate(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, err := verifyAuth(r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	userAnalyses.invalidate(userID)
+
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": false,
-		"error":   "Method not allowed",
+		"success":     true,
+		"invalidated": true,
+		"user_id":     userID,
+		"function":    "budget-analyzer",
+		"runtime":     "Go",
 	})
 }
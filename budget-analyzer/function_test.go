@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Stand-ins for auth-service and transaction-api. Every token belongs to
+// userID; transaction-api answers with transactions, or with status once
+// set to something other than 200.
+type testServices struct {
+	userID       string
+	transactions []Transaction
+	status       int32
+	authCalls    int32
+}
+
+func newTestServices(t *testing.T, userID string, transactions []Transaction) *testServices {
+	t.Helper()
+	services := &testServices{userID: userID, transactions: transactions, status: http.StatusOK}
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&services.authCalls, 1)
+		var response AuthServiceResponse
+		response.Success = true
+		response.User.ID = services.userID
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(auth.Close)
+	t.Setenv("AUTH_SERVICE_URL", auth.URL)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := int(atomic.LoadInt32(&services.status)); status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(TransactionAPIResponse{Success: true, Data: services.transactions})
+	}))
+	t.Cleanup(api.Close)
+	t.Setenv("TRANSACTION_API_URL", api.URL)
+
+	return services
+}
+
+// Calls the handler with the test's own token and decodes the JSON response
+func serveTestRequest(t *testing.T, method, target string, header http.Header) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	r := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	if r.Header.Get("Authorization") == "" {
+		r.Header.Set("Authorization", "Bearer token-"+t.Name())
+	}
+
+	w := httptest.NewRecorder()
+	BudgetAnalyzerHandler(w, r)
+
+	var body map[string]interface{}
+	if w.Code != http.StatusNotModified {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: invalid JSON response %q", method, target, w.Body.String())
+		}
+	}
+	return w, body
+}
+
+func TestStaleWhileError(t *testing.T) {
+	userID := "stale-test-user"
+	services := newTestServices(t, userID, []Transaction{
+		{ID: "t1", Category: "Dining", Amount: 40, Date: "2026-10-02", Type: "expense"},
+	})
+	if _, err := budgetStore.Create(userID, Budget{Category: "Dining", Amount: 300, Period: "monthly"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A good answer for the current period is kept...
+	if w, body := serveTestRequest(t, "GET", "/", nil); w.Code != http.StatusOK || body["stale"] != false {
+		t.Fatalf("status %d, stale %v; want 200, false", w.Code, body["stale"])
+	}
+	atomic.StoreInt32(&services.status, http.StatusBadGateway)
+
+	tests := []struct {
+		name   string
+		target string
+		stale  bool
+	}{
+		{"the same view is served stale", "/", true},
+		{"a month isn't answered with the current period", "/?month=2026-01", false},
+		{"nor is a custom range", "/?from=2026-01-01&to=2026-01-31", false},
+		{"nor another week start", "/?week_start=sunday", false},
+		{"nor other generation options", "/?mode=50-30-20", false},
+	}
+
+	// ...and served only to requests it answers
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, body := serveTestRequest(t, "GET", tt.target, nil)
+			if tt.stale {
+				if w.Code != http.StatusOK || body["stale"] != true {
+					t.Errorf("status %d, stale %v; want 200, true", w.Code, body["stale"])
+				}
+				return
+			}
+			if w.Code != http.StatusBadGateway && w.Code != http.StatusServiceUnavailable {
+				t.Errorf("status %d, want the upstream failure", w.Code)
+			}
+		})
+	}
+}
+
+func TestBudgetHealthScoreUsesStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		analysis BudgetAnalysis
+		want     float64
+	}{
+		{"over budget", BudgetAnalysis{Status: "over_budget", PercentageUsed: 104}, 0},
+		{"critical below the old 90% mark", BudgetAnalysis{Status: "critical", PercentageUsed: 70}, 20},
+		{"warning at a raised threshold", BudgetAnalysis{Status: "warning", PercentageUsed: 96}, 50},
+		{"on track at a raised threshold", BudgetAnalysis{Status: "on_track", PercentageUsed: 92}, 75},
+		{"well under", BudgetAnalysis{Status: "on_track", PercentageUsed: 20}, 100},
+	}
+
+	for _, tt := range tests {
+		if got := calculateBudgetHealthScore([]BudgetAnalysis{tt.analysis}); got != tt.want {
+			t.Errorf("%s: health score = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetRecommendationsNameCriticalCategories(t *testing.T) {
+	health := OverallBudgetHealth{
+		HealthScore:   40,
+		OverallStatus: "warning",
+		BudgetCategories: []BudgetAnalysis{
+			{Category: "Dining", Status: "over_budget"},
+			{Category: "Rent", Status: "critical"},
+			{Category: "Fun", Status: "critical"},
+			{Category: "Travel", Status: "warning"},
+		},
+	}
+
+	recommendations := generateBudgetRecommendations(health)
+	for _, want := range []string{"🎯 Focus on reducing: Dining", "🛑 Close to the limit, hold off on spending in: Rent, Fun"} {
+		found := false
+		for _, recommendation := range recommendations {
+			found = found || recommendation == want
+		}
+		if !found {
+			t.Errorf("recommendations %q don't include %q", recommendations, want)
+		}
+	}
+}
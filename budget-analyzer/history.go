@@ -0,0 +1,173 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// monthlyHistory holds per-month totals over a set of source months, the
+// basis for anything derived from "a typical month" rather than all-time sums
+type monthlyHistory struct {
+	Months   []time.Time                   // first day of each source month, oldest first
+	Expenses map[string]map[string]float64 // category -> YYYY-MM -> spent
+	Income   map[string]float64            // YYYY-MM -> earned
+}
+
+// sourceMonths picks the last `lookback` complete months before now, skipping
+// months before the user's first transaction. With no complete month of
+// history, the current month is the only source.
+func sourceMonths(transactions []Transaction, now time.Time, lookback int) []time.Time {
+	current := periodWindow("monthly", now, time.Monday).Start
+
+	var first time.Time
+	for _, transaction := range transactions {
+		at, err := parseTransactionDate(transaction.Date)
+		if err != nil {
+			continue
+		}
+		if first.IsZero() || at.Before(first) {
+			first = at
+		}
+	}
+
+	var months []time.Time
+	if !first.IsZero() {
+		firstMonth := periodWindow("monthly", first.In(now.Location()), time.Monday).Start
+		for i := lookback; i >= 1; i-- {
+			month := current.AddDate(0, -i, 0)
+			if !month.Before(firstMonth) {
+				months = append(months, month)
+			}
+		}
+	}
+
+	if len(months) == 0 {
+		months = []time.Time{current}
+	}
+	return months
+}
+
+func buildMonthlyHistory(transactions []Transaction, months []time.Time) monthlyHistory {
+	history := monthlyHistory{
+		Months:   months,
+		Expenses: make(map[string]map[string]float64),
+		Income:   make(map[string]float64),
+	}
+	if len(months) == 0 {
+		return history
+	}
+
+	span := budgetWindow{Start: months[0], End: months[len(months)-1].AddDate(0, 1, 0)}
+	for _, transaction := range transactions {
+		at, err := parseTransactionDate(transaction.Date)
+		if err != nil || !span.contains(at) {
+			continue
+		}
+		key := at.In(months[0].Location()).Format("2006-01")
+
+		switch transaction.Type {
+		case "expense":
+			if history.Expenses[transaction.Category] == nil {
+				history.Expenses[transaction.Category] = make(map[string]float64)
+			}
+			history.Expenses[transaction.Category][key] += transaction.Amount
+		case "income":
+			history.Income[key] += transaction.Amount
+		}
+	}
+
+	return history
+}
+
+func (h monthlyHistory) monthKeys() []string {
+	keys := make([]string, len(h.Months))
+	for i, month := range h.Months {
+		keys[i] = month.Format("2006-01")
+	}
+	return keys
+}
+
+// Spending in a category for each source month, zero-filled
+func (h monthlyHistory) categoryValues(category string) []float64 {
+	values := make([]float64, len(h.Months))
+	for i, key := range h.monthKeys() {
+		values[i] = h.Expenses[category][key]
+	}
+	return values
+}
+
+// Income for each source month, zero-filled
+func (h monthlyHistory) incomeValues() []float64 {
+	values := make([]float64, len(h.Months))
+	for i, key := range h.monthKeys() {
+		values[i] = h.Income[key]
+	}
+	return values
+}
+
+// Sorted category names with any spending in the history
+func (h monthlyHistory) categories() []string {
+	categories := make([]string, 0, len(h.Expenses))
+	for category := range h.Expenses {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// Percentile p of a category's monthly spend with outlier months left out,
+// along with the months used and the months excluded
+func categoryStatistic(h monthlyHistory, category string, p float64) (float64, []string, []string) {
+	monthKeys := h.monthKeys()
+	values := h.categoryValues(category)
+	outliers := outlierMask(values)
+
+	var kept []float64
+	var sourceKeys, excludedKeys []string
+	for i, value := range values {
+		if outliers[i] {
+			excludedKeys = append(excludedKeys, monthKeys[i])
+			continue
+		}
+		kept = append(kept, value)
+		sourceKeys = append(sourceKeys, monthKeys[i])
+	}
+
+	return percentile(kept, p), sourceKeys, excludedKeys
+}
+
+func median(values []float64) float64 {
+	return percentile(values, 50)
+}
+
+// Percentile with linear interpolation between closest ranks
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// outlierMask flags values outside Tukey's fences (1.5 IQR beyond the
+// quartiles). Fewer than four values are never treated as outliers.
+func outlierMask(values []float64) []bool {
+	mask := make([]bool, len(values))
+	if len(values) < 4 {
+		return mask
+	}
+
+	q1, q3 := percentile(values, 25), percentile(values, 75)
+	fence := 1.5 * (q3 - q1)
+	for i, value := range values {
+		mask[i] = value < q1-fence || value > q3+fence
+	}
+	return mask
+}
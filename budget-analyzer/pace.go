@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// How far ahead of the expected spending curve spend-to-date must be before
+// a pace alert fires, in % of the budget, so one early purchase stays quiet
+const paceAlertTolerance = 10.0
+
+const alertPace = "pace"
+
+// BudgetPace compares spend-to-date with the spending expected by now.
+// Recurring charges such as rent are expected on their due days, one-off
+// charges when they posted, and the rest of the budget evenly over the
+// period, so a fixed charge posting early doesn't put a budget ahead of pace.
+type BudgetPace struct {
+	ElapsedFraction  float64 `json:"elapsed_fraction"`          // share of the period elapsed, 0-1
+	ExpectedSpend    float64 `json:"expected_spend"`            // spend-to-date expected by now
+	PacePercentage   float64 `json:"pace_percentage"`           // spent as % of expected spend
+	ProjectedOverrun float64 `json:"projected_overrun"`         // predicted spend beyond the budget, 0 if none
+	ExhaustionDate   string  `json:"exhaustion_date,omitempty"` // when the budget runs out at the current rate
+	AheadOfPace      bool    `json:"ahead_of_pace"`             // spend-to-date is ahead of expected by more than the tolerance
+}
+
+// Pace of an open period against the spend prediction
+func budgetPace(budgeted, spent float64, prediction SpendPrediction, window budgetWindow, daysElapsed int, now time.Time) BudgetPace {
+	fraction := math.Min(float64(daysElapsed)/float64(window.days()), 1)
+	today := periodWindow("daily", now, time.Monday).Start
+
+	// Recurring charges already posted or due by today and one-off charges,
+	// plus the rest of the budget spread evenly
+	expected := prediction.RecurringPosted + prediction.OneOffSpent
+	for _, charge := range prediction.RecurringCharges {
+		if due, ok := recurringDueIn(charge.ExpectedDay, window); ok && !charge.Posted && !due.After(today) {
+			expected += charge.Amount
+		}
+	}
+	expected += math.Max(budgeted-prediction.RecurringPosted-prediction.RecurringPending-prediction.OneOffSpent, 0) * fraction
+
+	pace := BudgetPace{
+		ElapsedFraction:  math.Round(fraction*10000) / 10000,
+		ExpectedSpend:    math.Round(expected*100) / 100,
+		ProjectedOverrun: math.Round(math.Max(prediction.predicted-budgeted, 0)*100) / 100,
+	}
+	if expected > 0 {
+		pace.PacePercentage = math.Round(spent/expected*10000) / 100
+	}
+	pace.AheadOfPace = budgeted > 0 && (spent-expected)/budgeted*100 > paceAlertTolerance
+
+	// Once the recurring charges still to come are set aside, the rest of the
+	// budget lasts this many more days at the expected variable rate. When
+	// nothing is left it is exhausted already.
+	rate := prediction.dailyRate
+	switch remaining := budgeted - spent - prediction.RecurringPending; {
+	case remaining <= 0:
+		pace.ExhaustionDate = today.Format("2006-01-02")
+	case rate > 0:
+		exhausted := today.AddDate(0, 0, int(math.Ceil(remaining/rate)))
+		if exhausted.Before(window.End) {
+			pace.ExhaustionDate = exhausted.Format("2006-01-02")
+		}
+	}
+
+	return pace
+}
+
+// The alert for a budget whose spend-to-date is ahead of pace. Budgets
+// already over are covered by their threshold alert.
+func paceAlert(analysis BudgetAnalysis, now time.Time) (Alert, bool) {
+	pace := analysis.Pace
+	if pace == nil || !pace.AheadOfPace || analysis.PercentageUsed >= 100 || analysis.Budgeted <= 0 {
+		return Alert{}, false
+	}
+
+	alert := newAlert(alertPace, analysis.Category, alertLevelWarning, analysis.PeriodStart, now)
+	alert.Threshold = paceAlertTolerance // percentage points of the budget ahead of expected
+	alert.PercentageUsed = analysis.PercentageUsed
+	alert.Amount = math.Round(analysis.Spent*100) / 100
+	alert.Budgeted = analysis.Budgeted
+	alert.ProjectedOverrun = pace.ProjectedOverrun
+	alert.ExhaustionDate = pace.ExhaustionDate
+	alert.Message = fmt.Sprintf("%s is ahead of pace: $%.2f spent, $%.2f expected by now", analysis.Category, analysis.Spent, pace.ExpectedSpend)
+	if pace.ProjectedOverrun > 0 {
+		alert.Message += fmt.Sprintf(", on pace to overspend by $%.2f", pace.ProjectedOverrun)
+	}
+	if pace.ExhaustionDate != "" {
+		alert.Message += ", running out on " + pace.ExhaustionDate
+	}
+	return alert, true
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var october2026 = periodWindow("monthly", time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC), time.Monday)
+
+func testExpense(date, category string, amount float64, description string) expenseEntry {
+	at, _ := time.Parse("2006-01-02", date)
+	return expenseEntry{at: at.Add(12 * time.Hour), path: categoryPath(category), amount: amount, description: description}
+}
+
+func TestBudgetPace(t *testing.T) {
+	now := time.Date(2026, time.October, 5, 12, 0, 0, 0, time.UTC)
+	rent := func(day int, posted bool) []RecurringCharge {
+		return []RecurringCharge{{Description: "Rent", Amount: 1200, ExpectedDay: day, Posted: posted}}
+	}
+
+	tests := []struct {
+		name       string
+		spent      float64
+		prediction SpendPrediction
+		expected   float64
+		ahead      bool
+	}{
+		{
+			name:       "rent posted on the 1st is expected",
+			spent:      1300,
+			prediction: SpendPrediction{RecurringPosted: 1200, RecurringCharges: rent(1, true)},
+			expected:   1329.03, // 1200 + 800 * 5/31
+		},
+		{
+			name:       "rent overdue but not posted is still expected",
+			spent:      100,
+			prediction: SpendPrediction{RecurringPending: 1200, RecurringCharges: rent(3, false)},
+			expected:   1329.03,
+		},
+		{
+			name:       "rent due later isn't expected yet",
+			spent:      400,
+			prediction: SpendPrediction{RecurringPending: 1200, RecurringCharges: rent(20, false)},
+			expected:   129.03,
+			ahead:      true,
+		},
+		{
+			name:     "no recurring charges spreads the whole budget",
+			spent:    600,
+			expected: 322.58,
+			ahead:    true,
+		},
+		{
+			name:     "within the tolerance",
+			spent:    500,
+			expected: 322.58,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pace := budgetPace(2000, tt.spent, tt.prediction, october2026, 5, now)
+			if pace.ExpectedSpend != tt.expected || pace.AheadOfPace != tt.ahead {
+				t.Errorf("expected_spend, ahead_of_pace = %v, %v; want %v, %v", pace.ExpectedSpend, pace.AheadOfPace, tt.expected, tt.ahead)
+			}
+		})
+	}
+}
+
+func TestBudgetPaceExhaustion(t *testing.T) {
+	now := time.Date(2026, time.October, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		spent      float64
+		prediction SpendPrediction
+		want       string
+	}{
+		{"runs out before the end", 500, SpendPrediction{dailyRate: 100}, "2026-10-25"},
+		{"lasts the period", 500, SpendPrediction{dailyRate: 10}, ""},
+		{"pending rent leaves nothing", 900, SpendPrediction{RecurringPending: 1200, dailyRate: 10}, "2026-10-10"},
+	}
+
+	for _, tt := range tests {
+		if got := budgetPace(2000, tt.spent, tt.prediction, october2026, 10, now).ExhaustionDate; got != tt.want {
+			t.Errorf("%s: exhaustion_date = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Rent charged on the 1st doesn't fire a pace alert on the 3rd, whether it
+// is recognised as recurring or, without history, as a one-off; the same
+// spending in everyday purchases does
+func TestPaceAlertIgnoresEarlyFixedCharges(t *testing.T) {
+	now := time.Date(2026, time.October, 3, 12, 0, 0, 0, time.UTC)
+	current := []expenseEntry{
+		testExpense("2026-10-01", "Housing", 1500, "Rent"),
+		testExpense("2026-10-02", "Housing", 40, "Hardware store"),
+	}
+	everyday := []expenseEntry{
+		testExpense("2026-10-01", "Housing", 400, "Furniture"),
+		testExpense("2026-10-01", "Housing", 380, "Furniture"),
+		testExpense("2026-10-02", "Housing", 390, "Furniture"),
+		testExpense("2026-10-03", "Housing", 370, "Furniture"),
+	}
+	history := []expenseEntry{
+		testExpense("2026-07-01", "Housing", 1500, "Rent"),
+		testExpense("2026-08-01", "Housing", 1500, "Rent"),
+		testExpense("2026-09-01", "Housing", 1500, "Rent"),
+	}
+
+	tests := []struct {
+		name     string
+		expenses []expenseEntry
+		alert    bool
+	}{
+		{"recurring rent", append(append([]expenseEntry{}, history...), current...), false},
+		{"one-off rent", current, false},
+		{"everyday purchases", everyday, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prediction := predictSpend("Housing", tt.expenses, 1540, 2000, october2026, 3)
+			pace := budgetPace(2000, 1540, prediction, october2026, 3, now)
+			analysis := BudgetAnalysis{Category: "Housing", Budgeted: 2000, Spent: 1540, PercentageUsed: 77, PeriodStart: "2026-10-01", Pace: &pace}
+
+			alert, fired := paceAlert(analysis, now)
+			if fired != tt.alert {
+				t.Fatalf("pace alert fired = %v (expected spend %v), want %v", fired, pace.ExpectedSpend, tt.alert)
+			}
+			if fired && !strings.HasPrefix(alert.Message, "Housing is ahead of pace: $1540.00 spent") {
+				t.Errorf("message = %q", alert.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// budgetWindow is the half-open interval [Start, End) a budget is evaluated over
+type budgetWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (w budgetWindow) contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Calendar days covered by the window
+func (w budgetWindow) days() int {
+	return daysBetween(w.Start, w.End)
+}
+
+// Whole calendar days between two midnights, robust to DST shifts
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours()/24 + 0.5)
+}
+
+// Options shared by every budget evaluated in one analysis. A nil Range
+// evaluates each budget over its current period; otherwise every budget is
+// evaluated over Range, which may be a closed historical period.
+type analysisOptions struct {
+	Now       time.Time
+	WeekStart time.Weekday
+	Range     *budgetWindow
+	Alerts    AlertSettings // default thresholds for budgets without their own
+	Rules     []AlertRule   // the user's custom alert rules
+}
+
+func defaultAnalysisOptions() analysisOptions {
+	return analysisOptions{Now: time.Now(), WeekStart: getWeekStart(), Alerts: defaultAlertSettings()}
+}
+
+// Identifies the options an analysis result depends on, for cache keys.
+// Results change daily as periods progress, so the date is part of it.
+func (o analysisOptions) variant() string {
+	return o.Now.Format("2006-01-02") + "|" + o.view()
+}
+
+// The options an analysis result depends on other than the date
+func (o analysisOptions) view() string {
+	variant := o.WeekStart.String()
+	variant += fmt.Sprintf("|%g|%g|%g|%g", o.Alerts.WarningThreshold, o.Alerts.CriticalThreshold, o.Alerts.OverallWarningThreshold, o.Alerts.OverallCriticalThreshold)
+	for _, rule := range o.Rules {
+		variant += fmt.Sprintf("|r%d:%s:%s", rule.ID, rule.Level, rule.Expression)
+	}
+	if o.Range != nil {
+		variant += "|" + o.Range.Start.Format("2006-01-02") + "|" + o.Range.End.Format("2006-01-02")
+	}
+	return variant
+}
+
+// A window is closed once it has fully elapsed
+func (o analysisOptions) isClosed(window budgetWindow) bool {
+	return !window.End.After(o.Now)
+}
+
+var weekdaysByName = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func parseWeekday(value string) (time.Weekday, bool) {
+	day, ok := weekdaysByName[strings.ToLower(strings.TrimSpace(value))]
+	return day, ok
+}
+
+// First day of weekly budget windows, BUDGET_WEEK_START (default monday)
+func getWeekStart() time.Weekday {
+	if day, ok := parseWeekday(os.Getenv("BUDGET_WEEK_START")); ok {
+		return day
+	}
+	return time.Monday
+}
+
+// Reads analysis options from the query string, defaulting to the current
+// time and the configured week start
+func analysisOptionsFromQuery(r *http.Request) (analysisOptions, error) {
+	opts, err := baseAnalysisOptionsFromQuery(r)
+	if err != nil {
+		return opts, err
+	}
+
+	analysisRange, err := analysisRangeFromQuery(r, opts.Now)
+	if err != nil {
+		return opts, err
+	}
+	opts.Range = analysisRange
+
+	return opts, nil
+}
+
+// Options common to every mode, without an analysis range
+func baseAnalysisOptionsFromQuery(r *http.Request) (analysisOptions, error) {
+	opts := defaultAnalysisOptions()
+
+	if value := r.URL.Query().Get("week_start"); value != "" {
+		day, ok := parseWeekday(value)
+		if !ok {
+			return opts, validationError([]FieldError{{Field: "week_start", Message: "must be a day of the week, e.g. monday"}})
+		}
+		opts.WeekStart = day
+	}
+
+	return opts, nil
+}
+
+// Parses month=YYYY-MM, or from=YYYY-MM-DD with an optional inclusive
+// to=YYYY-MM-DD (default today). Returns nil when neither is given.
+func analysisRangeFromQuery(r *http.Request, now time.Time) (*budgetWindow, error) {
+	query := r.URL.Query()
+	month, from, to := query.Get("month"), query.Get("from"), query.Get("to")
+
+	if month == "" && from == "" && to == "" {
+		return nil, nil
+	}
+
+	if month != "" {
+		if from != "" || to != "" {
+			return nil, validationError([]FieldError{{Field: "month", Message: "cannot be combined with from/to"}})
+		}
+		start, err := time.ParseInLocation("2006-01", month, now.Location())
+		if err != nil {
+			return nil, validationError([]FieldError{{Field: "month", Message: "must be formatted as YYYY-MM"}})
+		}
+		if start.After(now) {
+			return nil, validationError([]FieldError{{Field: "month", Message: "must not be in the future"}})
+		}
+		window := periodWindow("monthly", start, time.Monday)
+		return &window, nil
+	}
+
+	var details []FieldError
+	if from == "" {
+		return nil, validationError([]FieldError{{Field: "from", Message: "is required when to is given"}})
+	}
+	start, err := time.ParseInLocation("2006-01-02", from, now.Location())
+	if err != nil {
+		details = append(details, FieldError{Field: "from", Message: "must be formatted as YYYY-MM-DD"})
+	} else if start.After(now) {
+		details = append(details, FieldError{Field: "from", Message: "must not be in the future"})
+	}
+
+	end := periodWindow("daily", now, time.Monday).Start
+	if to != "" {
+		if end, err = time.ParseInLocation("2006-01-02", to, now.Location()); err != nil {
+			details = append(details, FieldError{Field: "to", Message: "must be formatted as YYYY-MM-DD"})
+		}
+	}
+	if len(details) > 0 {
+		return nil, validationError(details)
+	}
+	if end.Before(start) {
+		return nil, validationError([]FieldError{{Field: "to", Message: "must not be before from"}})
+	}
+
+	// `to` is inclusive; windows are half-open
+	return &budgetWindow{Start: start, End: end.AddDate(0, 0, 1)}, nil
+}
+
+// Budget period, treating a missing period as monthly
+func normalizePeriod(period string) string {
+	if validPeriods[period] {
+		return period
+	}
+	return "monthly"
+}
+
+// The window of the given period that contains `at`
+func periodWindow(period string, at time.Time, weekStart time.Weekday) budgetWindow {
+	year, month, day := at.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, at.Location())
+
+	switch normalizePeriod(period) {
+	case "daily":
+		return budgetWindow{Start: midnight, End: midnight.AddDate(0, 0, 1)}
+	case "weekly":
+		offset := (int(midnight.Weekday()) - int(weekStart) + 7) % 7
+		start := midnight.AddDate(0, 0, -offset)
+		return budgetWindow{Start: start, End: start.AddDate(0, 0, 7)}
+	default:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, at.Location())
+		return budgetWindow{Start: start, End: start.AddDate(0, 1, 0)}
+	}
+}
+
+// Days of the window up to and including now's day. Spend-to-date includes
+// today's expenses, so rates derived from it must count today as elapsed.
+func elapsedDays(window budgetWindow, now time.Time) int {
+	days := daysBetween(window.Start, periodWindow("daily", now, time.Monday).Start) + 1
+	if days < 1 {
+		return 1
+	}
+	if total := window.days(); days > total {
+		return total
+	}
+	return days
+}
+
+// Calculate days passed and remaining in a budget window
+func calculatePeriodProgress(window budgetWindow, now time.Time) (daysPassed int, daysRemaining int) {
+	// Days passed since start of the period
+	daysPassed = int(now.Sub(window.Start).Hours() / 24)
+
+	// Days remaining
+	daysRemaining = window.days() - daysPassed
+
+	if daysPassed <= 0 {
+		daysPassed = 1 // Minimum 1 day passed
+	}
+	if daysRemaining <= 0 {
+		daysRemaining = 1 // Minimum 1 day remaining
+	}
+
+	return daysPassed, daysRemaining
+}
+
+// Scales a budget amount for one period to an arbitrary window. A window that
+// is exactly one of the budget's periods keeps the amount unchanged.
+func scaleToWindow(amount float64, period string, window budgetWindow, weekStart time.Weekday) float64 {
+	natural := periodWindow(period, window.Start, weekStart)
+	if natural == window || natural.days() == 0 {
+		return amount
+	}
+	return amount * float64(window.days()) / float64(natural.days())
+}
+
+// Scales a budget amount for one period to the equivalent amount over the
+// month containing `at`, so budgets with different periods can be totalled
+func monthlyEquivalent(amount float64, period string, at time.Time, weekStart time.Weekday) float64 {
+	periodDays := periodWindow(period, at, weekStart).days()
+	monthDays := periodWindow("monthly", at, weekStart).days()
+	if periodDays == 0 {
+		return amount
+	}
+	return amount * float64(monthDays) / float64(periodDays)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tuning for spend prediction
+const (
+	predictionLookbackMonths = 6     // prior months used to learn recurring charges and seasonality
+	recurringAmountTolerance = 0.10  // a repeat charge may differ from its usual amount by 10%
+	recurringDayTolerance    = 3     // ...and land within 3 days of its usual day of month
+	minSeasonalHistoryDays   = 28    // history needed before day-of-week patterns are trusted
+	predictionZ              = 1.645 // two-sided 90% interval
+	oneOffBudgetShare        = 0.25  // without history, a charge this share of the budget isn't extrapolated
+)
+
+// A charge that repeats every month, such as rent or a subscription
+type RecurringCharge struct {
+	Description string  `json:"description,omitempty"`
+	Amount      float64 `json:"amount"`
+	ExpectedDay int     `json:"expected_day"` // day of month
+	Posted      bool    `json:"posted"`       // already charged this period
+}
+
+// SpendPrediction is the forecast behind PredictedSpend. Recurring charges
+// are forecast as the charges themselves; the rest is variable spend,
+// projected over the remaining days with day-of-week seasonality when there
+// is enough history, or linearly otherwise. Without the history to recognise
+// recurring charges, a single charge taking a large share of the budget,
+// such as rent on the 1st, is taken as a one-off and not projected.
+type SpendPrediction struct {
+	Method           string            `json:"method"` // linear, seasonal, recurring+linear, recurring+seasonal
+	Low              float64           `json:"low"`    // 90% prediction interval
+	High             float64           `json:"high"`
+	RecurringPosted  float64           `json:"recurring_posted"`
+	RecurringPending float64           `json:"recurring_pending"` // recurring charges still expected this period
+	VariableSpent    float64           `json:"variable_spent"`
+	OneOffSpent      float64           `json:"one_off_spent,omitempty"` // part of the variable spend left out of the daily rate
+	VariableForecast float64           `json:"variable_forecast"`       // variable spend expected over the remaining days
+	RecurringCharges []RecurringCharge `json:"recurring_charges,omitempty"`
+
+	predicted float64
+	dailyRate float64 // expected variable spend per remaining day
+}
+
+// Identifies repeats of a charge: its description, or its rounded amount
+func recurringKey(expense expenseEntry) string {
+	if description := strings.ToLower(strings.TrimSpace(expense.description)); description != "" {
+		return description
+	}
+	return fmt.Sprintf("$%.0f", expense.amount)
+}
+
+func withinTolerance(amount, usual float64) bool {
+	return math.Abs(amount-usual) <= usual*recurringAmountTolerance
+}
+
+// Finds charges seen once a month in at least two of the prior months at a
+// similar amount and day of month, the latest within the last two months
+func detectRecurringCharges(history []expenseEntry, before time.Time) map[string]*RecurringCharge {
+	byKey := make(map[string]map[string]expenseEntry)
+	repeated := make(map[string]bool) // charged more than once in some month
+	for _, expense := range history {
+		key := recurringKey(expense)
+		if byKey[key] == nil {
+			byKey[key] = make(map[string]expenseEntry)
+		}
+		month := expense.at.Format("2006-01")
+		if _, ok := byKey[key][month]; ok {
+			repeated[key] = true
+		}
+		byKey[key][month] = expense
+	}
+
+	recentCutoff := periodWindow("monthly", before, time.Monday).Start.AddDate(0, -2, 0)
+	charges := make(map[string]*RecurringCharge)
+	for key, months := range byKey {
+		if len(months) < 2 || repeated[key] {
+			continue
+		}
+
+		var amounts, days []float64
+		var latest time.Time
+		var description string
+		for _, expense := range months {
+			amounts = append(amounts, expense.amount)
+			days = append(days, float64(expense.at.Day()))
+			if expense.at.After(latest) {
+				latest = expense.at
+				description = expense.description
+			}
+		}
+		usualAmount, usualDay := median(amounts), median(days)
+
+		consistent := !latest.Before(recentCutoff)
+		for i := range amounts {
+			if !withinTolerance(amounts[i], usualAmount) || math.Abs(days[i]-usualDay) > recurringDayTolerance {
+				consistent = false
+			}
+		}
+		if consistent {
+			charges[key] = &RecurringCharge{
+				Description: strings.TrimSpace(description),
+				Amount:      math.Round(usualAmount*100) / 100,
+				ExpectedDay: int(math.Round(usualDay)),
+			}
+		}
+	}
+	return charges
+}
+
+// The day a recurring charge is due in the month containing at, clamped to
+// the month's length
+func recurringDueDate(day int, at time.Time) time.Time {
+	month := periodWindow("monthly", at, time.Monday)
+	if last := month.days(); day > last {
+		day = last
+	}
+	return month.Start.AddDate(0, 0, day-1)
+}
+
+// When a recurring charge falls due in the window, if it does
+func recurringDueIn(day int, window budgetWindow) (time.Time, bool) {
+	for _, at := range []time.Time{window.Start, window.End.AddDate(0, 0, -1)} {
+		if due := recurringDueDate(day, at); window.contains(due) {
+			return due, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Average spend per weekday and its variance over the history, from the
+// first day with any spending up to the window
+type weekdayProfile struct {
+	mean     [7]float64
+	variance [7]float64
+}
+
+func buildWeekdayProfile(daily map[string]float64, from, to time.Time) (weekdayProfile, bool) {
+	var profile weekdayProfile
+	if daysBetween(from, to) < minSeasonalHistoryDays {
+		return profile, false
+	}
+
+	var values [7][]float64
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		values[day.Weekday()] = append(values[day.Weekday()], daily[day.Format("2006-01-02")])
+	}
+
+	for weekday, samples := range values {
+		if len(samples) == 0 {
+			continue
+		}
+		sum := 0.0
+		for _, value := range samples {
+			sum += value
+		}
+		mean := sum / float64(len(samples))
+
+		squares := 0.0
+		for _, value := range samples {
+			squares += (value - mean) * (value - mean)
+		}
+		profile.mean[weekday] = mean
+		if len(samples) > 1 {
+			profile.variance[weekday] = squares / float64(len(samples)-1)
+		}
+	}
+	return profile, true
+}
+
+// Predicts a category's total spend over an open window, daysElapsed days of
+// which (today included) are already behind
+func predictSpend(category string, expenses []expenseEntry, spent, budgeted float64, window budgetWindow, daysElapsed int) SpendPrediction {
+	category = canonicalCategory(category)
+	historyStart := periodWindow("monthly", window.Start, time.Monday).Start.AddDate(0, -predictionLookbackMonths, 0)
+
+	var history, current []expenseEntry
+	firstHistoryDay := window.Start
+	for _, expense := range expenses {
+		if !categoryWithin(expense.path, category) {
+			continue
+		}
+		switch {
+		case window.contains(expense.at):
+			current = append(current, expense)
+		case !expense.at.Before(historyStart) && expense.at.Before(window.Start):
+			history = append(history, expense)
+			if day := periodWindow("daily", expense.at, time.Monday).Start; day.Before(firstHistoryDay) {
+				firstHistoryDay = day
+			}
+		}
+	}
+
+	prediction := SpendPrediction{}
+	charges := detectRecurringCharges(history, window.Start)
+
+	// Split this period's spending into recurring and variable
+	var variable []expenseEntry
+	for _, expense := range current {
+		if charge, ok := charges[recurringKey(expense)]; ok && !charge.Posted && withinTolerance(expense.amount, charge.Amount) {
+			charge.Posted = true
+			prediction.RecurringPosted += expense.amount
+			continue
+		}
+		prediction.VariableSpent += expense.amount
+		variable = append(variable, expense)
+	}
+
+	// Recurring charges still to come in this window
+	keys := make([]string, 0, len(charges))
+	for key := range charges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		charge := charges[key]
+		if _, ok := recurringDueIn(charge.ExpectedDay, window); ok && !charge.Posted {
+			prediction.RecurringPending += charge.Amount
+		}
+		prediction.RecurringCharges = append(prediction.RecurringCharges, *charge)
+	}
+
+	// Variable spend over the remaining days
+	remainingStart := window.Start.AddDate(0, 0, daysElapsed)
+	remainingDays := daysBetween(remainingStart, window.End)
+	if remainingDays < 0 {
+		remainingDays = 0
+	}
+
+	historyDaily := make(map[string]float64)
+	for _, expense := range history {
+		if _, ok := charges[recurringKey(expense)]; ok {
+			continue
+		}
+		historyDaily[expense.at.Format("2006-01-02")] += expense.amount
+	}
+
+	variance := 0.0
+	if profile, ok := buildWeekdayProfile(historyDaily, firstHistoryDay, window.Start); ok {
+		prediction.Method = "seasonal"
+
+		// Scale the usual pattern by how this period compares with it so far
+		expectedSoFar := 0.0
+		for day := window.Start; day.Before(remainingStart); day = day.AddDate(0, 0, 1) {
+			expectedSoFar += profile.mean[day.Weekday()]
+		}
+		scale := 1.0
+		if expectedSoFar > 0 {
+			scale = math.Min(math.Max(prediction.VariableSpent/expectedSoFar, 0.25), 4)
+		}
+
+		for day := remainingStart; day.Before(window.End); day = day.AddDate(0, 0, 1) {
+			prediction.VariableForecast += profile.mean[day.Weekday()] * scale
+			variance += profile.variance[day.Weekday()] * scale * scale
+		}
+	} else {
+		prediction.Method = "linear"
+
+		daily := make(map[string]float64)
+		for _, expense := range variable {
+			if budgeted > 0 && expense.amount >= budgeted*oneOffBudgetShare {
+				prediction.OneOffSpent += expense.amount
+				continue
+			}
+			daily[expense.at.Format("2006-01-02")] += expense.amount
+		}
+		var variableDays []float64
+		for day := window.Start; day.Before(remainingStart); day = day.AddDate(0, 0, 1) {
+			variableDays = append(variableDays, daily[day.Format("2006-01-02")])
+		}
+
+		rate := (prediction.VariableSpent - prediction.OneOffSpent) / float64(daysElapsed)
+		prediction.VariableForecast = rate * float64(remainingDays)
+		if len(variableDays) > 1 {
+			squares := 0.0
+			for _, value := range variableDays {
+				squares += (value - rate) * (value - rate)
+			}
+			variance = squares / float64(len(variableDays)-1) * float64(remainingDays)
+		} else {
+			// A single day says little about variability
+			variance = math.Pow(prediction.VariableForecast/2, 2)
+		}
+	}
+	if len(charges) > 0 {
+		prediction.Method = "recurring+" + prediction.Method
+	}
+
+	if remainingDays > 0 {
+		prediction.dailyRate = prediction.VariableForecast / float64(remainingDays)
+	}
+	prediction.predicted = spent + prediction.RecurringPending + prediction.VariableForecast
+
+	margin := predictionZ * math.Sqrt(variance)
+	prediction.Low = math.Round(math.Max(prediction.predicted-margin, spent+prediction.RecurringPending)*100) / 100
+	prediction.High = math.Round((prediction.predicted+margin)*100) / 100
+	prediction.RecurringPosted = math.Round(prediction.RecurringPosted*100) / 100
+	prediction.RecurringPending = math.Round(prediction.RecurringPending*100) / 100
+	prediction.VariableSpent = math.Round(prediction.VariableSpent*100) / 100
+	prediction.OneOffSpent = math.Round(prediction.OneOffSpent*100) / 100
+	prediction.VariableForecast = math.Round(prediction.VariableForecast*100) / 100
+
+	return prediction
+}
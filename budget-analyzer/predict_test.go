@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectRecurringCharges(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []expenseEntry
+		want    *RecurringCharge
+	}{
+		{
+			name: "two months at the same day and amount",
+			history: []expenseEntry{
+				testExpense("2026-08-01", "Housing", 1500, "Rent"),
+				testExpense("2026-09-02", "Housing", 1510, "Rent"),
+			},
+			want: &RecurringCharge{Description: "Rent", Amount: 1505, ExpectedDay: 2},
+		},
+		{
+			name:    "a single month",
+			history: []expenseEntry{testExpense("2026-09-01", "Housing", 1500, "Rent")},
+		},
+		{
+			name: "amounts too far apart",
+			history: []expenseEntry{
+				testExpense("2026-08-01", "Housing", 1500, "Rent"),
+				testExpense("2026-09-01", "Housing", 900, "Rent"),
+			},
+		},
+		{
+			name: "days too far apart",
+			history: []expenseEntry{
+				testExpense("2026-08-01", "Housing", 1500, "Rent"),
+				testExpense("2026-09-20", "Housing", 1500, "Rent"),
+			},
+		},
+		{
+			name: "charged twice in a month",
+			history: []expenseEntry{
+				testExpense("2026-08-01", "Housing", 1500, "Rent"),
+				testExpense("2026-08-02", "Housing", 1500, "Rent"),
+				testExpense("2026-09-01", "Housing", 1500, "Rent"),
+			},
+		},
+		{
+			name: "stopped more than two months ago",
+			history: []expenseEntry{
+				testExpense("2026-05-01", "Housing", 1500, "Rent"),
+				testExpense("2026-06-01", "Housing", 1500, "Rent"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charges := detectRecurringCharges(tt.history, october2026.Start)
+			charge, found := charges["rent"]
+			if found != (tt.want != nil) {
+				t.Fatalf("detected %v, want %v", found, tt.want != nil)
+			}
+			if found && *charge != *tt.want {
+				t.Errorf("charge = %+v, want %+v", *charge, *tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictSpend(t *testing.T) {
+	rentHistory := []expenseEntry{
+		testExpense("2026-08-01", "Housing", 1500, "Rent"),
+		testExpense("2026-09-01", "Housing", 1500, "Rent"),
+	}
+
+	tests := []struct {
+		name        string
+		expenses    []expenseEntry
+		spent       float64
+		daysElapsed int
+		method      string
+		oneOff      float64
+		pending     float64
+		predicted   float64
+	}{
+		{
+			name:        "rent on day 1 without history isn't extrapolated",
+			expenses:    []expenseEntry{testExpense("2026-10-01", "Housing", 1500, "Rent")},
+			spent:       1500,
+			daysElapsed: 1,
+			method:      "linear",
+			oneOff:      1500,
+			predicted:   1500,
+		},
+		{
+			name: "small purchases are extrapolated",
+			expenses: []expenseEntry{
+				testExpense("2026-10-01", "Housing", 1500, "Rent"),
+				testExpense("2026-10-01", "Housing", 20, "Hardware store"),
+				testExpense("2026-10-03", "Housing", 40, "Hardware store"),
+			},
+			spent:       1560,
+			daysElapsed: 3,
+			method:      "linear",
+			oneOff:      1500,
+			predicted:   2120, // 1560 + 20 a day for 28 days
+		},
+		{
+			name:        "recurring rent not yet posted is expected",
+			expenses:    append([]expenseEntry{testExpense("2026-10-02", "Housing", 60, "Hardware store")}, rentHistory...),
+			spent:       60,
+			daysElapsed: 3,
+			method:      "recurring+seasonal",
+			pending:     1500,
+			predicted:   1560, // no variable spend in the history to project
+		},
+		{
+			name:        "posted recurring rent isn't a one-off",
+			expenses:    append([]expenseEntry{testExpense("2026-10-01", "Housing", 1500, "Rent")}, rentHistory...),
+			spent:       1500,
+			daysElapsed: 3,
+			method:      "recurring+seasonal",
+			predicted:   1500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prediction := predictSpend("Housing", tt.expenses, tt.spent, 2000, october2026, tt.daysElapsed)
+			if prediction.Method != tt.method || prediction.OneOffSpent != tt.oneOff || prediction.RecurringPending != tt.pending {
+				t.Errorf("method, one_off_spent, recurring_pending = %s, %v, %v; want %s, %v, %v", prediction.Method, prediction.OneOffSpent, prediction.RecurringPending, tt.method, tt.oneOff, tt.pending)
+			}
+			if prediction.predicted != tt.predicted {
+				t.Errorf("predicted = %v, want %v", prediction.predicted, tt.predicted)
+			}
+			if prediction.Low > prediction.predicted || prediction.High < prediction.predicted {
+				t.Errorf("interval [%v, %v] doesn't contain %v", prediction.Low, prediction.High, prediction.predicted)
+			}
+		})
+	}
+}
+
+func TestElapsedDays(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(2026, time.October, 18, 23, 59, 0, 0, time.UTC), 18},
+		{time.Date(2026, time.October, 31, 12, 0, 0, 0, time.UTC), 31},
+	}
+
+	for _, tt := range tests {
+		if got := elapsedDays(october2026, tt.now); got != tt.want {
+			t.Errorf("elapsedDays(%s) = %d, want %d", tt.now.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Limits for multi-month reports
+const (
+	defaultReportMonths = 6
+	maxReportMonths     = 36
+)
+
+// One category's result for one month of a report
+type MonthlyCategoryResult struct {
+	Month    string  `json:"month"` // YYYY-MM
+	Budgeted float64 `json:"budgeted"`
+	Actual   float64 `json:"actual"`
+	Variance float64 `json:"variance"` // budgeted - actual, negative when overspent
+	Status   string  `json:"status"`   // under_budget, on_budget, over_budget, in_progress
+}
+
+// A run of consecutive closed months with the same outcome
+type BudgetStreak struct {
+	Type   string `json:"type"` // on_budget, over_budget
+	Length int    `json:"length"`
+}
+
+type CategoryReport struct {
+	Category                string                  `json:"category"`
+	Months                  []MonthlyCategoryResult `json:"months"`
+	TotalBudgeted           float64                 `json:"total_budgeted"`
+	TotalActual             float64                 `json:"total_actual"`
+	TotalVariance           float64                 `json:"total_variance"`
+	CurrentStreak           *BudgetStreak           `json:"current_streak,omitempty"`
+	LongestOnBudgetStreak   int                     `json:"longest_on_budget_streak"`
+	LongestOverBudgetStreak int                     `json:"longest_over_budget_streak"`
+	AdherenceRate           float64                 `json:"adherence_rate"` // % of closed months on or under budget
+}
+
+type BudgetReport struct {
+	From                 string           `json:"from"`
+	To                   string           `json:"to"`
+	Months               []string         `json:"months"`
+	Categories           []CategoryReport `json:"categories"`
+	ClosedMonths         int              `json:"closed_months"`
+	OverallAdherenceRate float64          `json:"overall_adherence_rate"` // % of closed category-months on or under budget
+}
+
+// Parses from=YYYY-MM and to=YYYY-MM, defaulting to the six months ending
+// with the current one
+func reportRangeFromQuery(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	current := periodWindow("monthly", now, time.Monday).Start
+
+	to := current
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01", value, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, validationError([]FieldError{{Field: "to", Message: "must be formatted as YYYY-MM"}})
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, -(defaultReportMonths - 1), 0)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01", value, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, validationError([]FieldError{{Field: "from", Message: "must be formatted as YYYY-MM"}})
+		}
+		from = parsed
+	}
+
+	switch {
+	case to.After(current):
+		return time.Time{}, time.Time{}, validationError([]FieldError{{Field: "to", Message: "must not be in the future"}})
+	case to.Before(from):
+		return time.Time{}, time.Time{}, validationError([]FieldError{{Field: "to", Message: "must not be before from"}})
+	case monthsBetween(from, to)+1 > maxReportMonths:
+		return time.Time{}, time.Time{}, validationError([]FieldError{{Field: "from", Message: "report range must not exceed 36 months"}})
+	}
+
+	return from, to, nil
+}
+
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
+
+// Budget vs. actual for every month in [from, to], reusing the single-period
+// analysis for each month so reports and month views always agree
+func buildBudgetReport(budgets []Budget, transactions []Transaction, from, to time.Time, opts analysisOptions) BudgetReport {
+	report := BudgetReport{
+		From: from.Format("2006-01"),
+		To:   to.Format("2006-01"),
+	}
+
+	categoryIndex := make(map[string]int)
+	for _, budget := range budgets {
+		key := strings.ToLower(canonicalCategory(budget.Category))
+		if _, ok := categoryIndex[key]; !ok {
+			categoryIndex[key] = len(report.Categories)
+			report.Categories = append(report.Categories, CategoryReport{Category: budget.Category})
+		}
+	}
+
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		window := periodWindow("monthly", month, opts.WeekStart)
+		monthOpts := opts
+		monthOpts.Range = &window
+		closed := opts.isClosed(window)
+
+		report.Months = append(report.Months, month.Format("2006-01"))
+		if closed {
+			report.ClosedMonths++
+		}
+
+		for _, analysis := range analyzeBudgets(budgets, transactions, monthOpts).BudgetCategories {
+			status := analysis.Verdict
+			if !closed {
+				status = "in_progress"
+			}
+
+			category := &report.Categories[categoryIndex[strings.ToLower(canonicalCategory(analysis.Category))]]
+			category.Months = append(category.Months, MonthlyCategoryResult{
+				Month:    month.Format("2006-01"),
+				Budgeted: analysis.Budgeted,
+				Actual:   math.Round(analysis.Spent*100) / 100,
+				Variance: math.Round((analysis.Budgeted-analysis.Spent)*100) / 100,
+				Status:   status,
+			})
+		}
+	}
+
+	var onBudgetTotal, closedTotal int
+	for i := range report.Categories {
+		onBudget, closedMonths := summarizeCategoryReport(&report.Categories[i])
+		onBudgetTotal += onBudget
+		closedTotal += closedMonths
+	}
+	if closedTotal > 0 {
+		report.OverallAdherenceRate = math.Round(float64(onBudgetTotal)/float64(closedTotal)*10000) / 100
+	}
+
+	return report
+}
+
+// Fills in totals, streaks and adherence for one category, returning the
+// number of on-budget and closed months it contributed
+func summarizeCategoryReport(category *CategoryReport) (onBudget int, closedMonths int) {
+	var runType string
+	var runLength int
+
+	for _, month := range category.Months {
+		category.TotalBudgeted += month.Budgeted
+		category.TotalActual += month.Actual
+
+		if month.Status == "in_progress" {
+			continue
+		}
+		closedMonths++
+
+		outcome := "over_budget"
+		if month.Status != "over_budget" {
+			outcome = "on_budget"
+			onBudget++
+		}
+
+		if outcome == runType {
+			runLength++
+		} else {
+			runType, runLength = outcome, 1
+		}
+
+		if outcome == "on_budget" && runLength > category.LongestOnBudgetStreak {
+			category.LongestOnBudgetStreak = runLength
+		} else if outcome == "over_budget" && runLength > category.LongestOverBudgetStreak {
+			category.LongestOverBudgetStreak = runLength
+		}
+	}
+
+	category.TotalBudgeted = math.Round(category.TotalBudgeted*100) / 100
+	category.TotalActual = math.Round(category.TotalActual*100) / 100
+	category.TotalVariance = math.Round((category.TotalBudgeted-category.TotalActual)*100) / 100
+
+	if runLength > 0 {
+		category.CurrentStreak = &BudgetStreak{Type: runType, Length: runLength}
+	}
+	if closedMonths > 0 {
+		category.AdherenceRate = math.Round(float64(onBudget)/float64(closedMonths)*10000) / 100
+	}
+
+	return onBudget, closedMonths
+}
+
+// Multi-month budget vs. actual report for the authenticated user
+func handleReport(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, authToken, err := requireAuth(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	opts, err := baseAnalysisOptionsFromQuery(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	if opts, err = withUserAlertSettings(opts, userID); err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	from, to, err := reportRangeFromQuery(r, opts.Now)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	genOpts, err := generationOptionsFromQuery(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	transactions, err := fetchTransactions(authToken)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	budgets, budgetSource, err := budgetsForUser(userID, transactions, genOpts)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	startTime := time.Now()
+	report := buildBudgetReport(budgets, transactions, from, to, opts)
+	processingTime := time.Since(startTime).Milliseconds()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":            true,
+		"data":               report,
+		"budgets":            budgets,
+		"budget_source":      budgetSource,
+		"transaction_count":  len(transactions),
+		"computed_at":        time.Now().Unix(),
+		"processing_time_ms": processingTime,
+		"function":           "budget-analyzer",
+		"runtime":            "Go",
+	})
+}
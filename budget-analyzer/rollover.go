@@ -0,0 +1,64 @@
+package main
+
+import "time"
+
+// How far back unspent or overspent amounts are carried forward
+const rolloverLookbackMonths = 12
+
+// rolloverCarry computes the amount a rollover budget carries into window:
+// the running surplus (positive) or deficit (negative) of every earlier
+// period, starting with the period containing the budget's rollover_from day
+// and bounded to the last twelve months. Without a rollover_from nothing is
+// carried, since there is no telling when the budget began. A non-zero cap
+// bounds the running balance in both directions.
+func rolloverCarry(budget Budget, expenses []expenseEntry, window budgetWindow, weekStart time.Weekday) float64 {
+	if !budget.Rollover || budget.RolloverFrom == "" {
+		return 0
+	}
+	historyStart, err := time.ParseInLocation("2006-01-02", budget.RolloverFrom, window.Start.Location())
+	if err != nil {
+		return 0
+	}
+
+	period := normalizePeriod(budget.Period)
+	if lookback := window.Start.AddDate(0, -rolloverLookbackMonths, 0); historyStart.Before(lookback) {
+		historyStart = lookback
+	}
+
+	carry := 0.0
+	prior := periodWindow(period, historyStart, weekStart)
+	for !prior.End.After(window.Start) {
+		carry += budget.Amount - spentInWindow(expenses, budget.Category, prior)
+		if budget.RolloverCap > 0 {
+			carry = clampCarry(carry, budget.RolloverCap)
+		}
+		prior = periodWindow(period, prior.End, weekStart)
+	}
+
+	return carry
+}
+
+// Defaults a stored budget's rollover start: kept from the previous version
+// of the budget while rollover stays on, otherwise today
+func defaultRolloverFrom(budget Budget, previous *Budget, now time.Time) Budget {
+	switch {
+	case !budget.Rollover:
+		budget.RolloverFrom = ""
+	case budget.RolloverFrom != "":
+	case previous != nil && previous.Rollover && previous.RolloverFrom != "":
+		budget.RolloverFrom = previous.RolloverFrom
+	default:
+		budget.RolloverFrom = now.UTC().Format("2006-01-02")
+	}
+	return budget
+}
+
+func clampCarry(carry, limit float64) float64 {
+	if carry > limit {
+		return limit
+	}
+	if carry < -limit {
+		return -limit
+	}
+	return carry
+}
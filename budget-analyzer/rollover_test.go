@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRolloverCarry(t *testing.T) {
+	expenses := []expenseEntry{
+		testExpense("2026-08-10", "Dining", 200, "Bistro"),
+		testExpense("2026-09-05", "Dining > Coffee", 350, "Cafe"), // subcategories count
+		testExpense("2026-10-02", "Dining", 30, "Bistro"),
+		testExpense("2026-10-06", "Dining", 150, "Bistro"),
+		testExpense("2026-09-20", "Groceries", 500, "Market"),
+	}
+	monthly := Budget{Category: "Dining", Amount: 300, Period: "monthly", Rollover: true, RolloverFrom: "2026-08-01"}
+	withChange := func(budget Budget, change func(budget *Budget)) Budget {
+		change(&budget)
+		return budget
+	}
+
+	tests := []struct {
+		name   string
+		budget Budget
+		window budgetWindow
+		want   float64
+	}{
+		{"surplus and deficit net out", monthly, october2026, 50},
+		{"not a rollover budget", withChange(monthly, func(b *Budget) { b.Rollover = false }), october2026, 0},
+		{"no rollover start", withChange(monthly, func(b *Budget) { b.RolloverFrom = "" }), october2026, 0},
+		{"starts with the period containing the start day", withChange(monthly, func(b *Budget) { b.RolloverFrom = "2026-09-15" }), october2026, -50},
+		{"cap bounds the running balance", withChange(monthly, func(b *Budget) { b.RolloverCap = 60 }), october2026, 10},
+		{"at most twelve months back", withChange(monthly, func(b *Budget) { b.RolloverFrom = "2024-01-01" }), october2026, 12*300 - 550},
+		{
+			"weekly periods",
+			Budget{Category: "Dining", Amount: 100, Period: "weekly", Rollover: true, RolloverFrom: "2026-10-01"},
+			periodWindow("weekly", time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC), time.Monday),
+			20, // (100 - 30) + (100 - 150)
+		},
+	}
+
+	for _, tt := range tests {
+		if got := rolloverCarry(tt.budget, expenses, tt.window, time.Monday); got != tt.want {
+			t.Errorf("%s: carry = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultRolloverFrom(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	previous := &Budget{Rollover: true, RolloverFrom: "2026-06-01"}
+
+	tests := []struct {
+		name     string
+		budget   Budget
+		previous *Budget
+		want     string
+	}{
+		{"new rollover budget starts today", Budget{Rollover: true}, nil, "2026-10-18"},
+		{"explicit start is kept", Budget{Rollover: true, RolloverFrom: "2026-09-01"}, previous, "2026-09-01"},
+		{"update keeps the earlier start", Budget{Rollover: true}, previous, "2026-06-01"},
+		{"turning rollover back on starts afresh", Budget{Rollover: true}, &Budget{RolloverFrom: "2026-06-01"}, "2026-10-18"},
+		{"no rollover, no start", Budget{RolloverFrom: "2026-09-01"}, previous, ""},
+	}
+
+	for _, tt := range tests {
+		if got := defaultRolloverFrom(tt.budget, tt.previous, now).RolloverFrom; got != tt.want {
+			t.Errorf("%s: rollover_from = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
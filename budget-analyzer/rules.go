@@ -0,0 +1,648 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Custom alert rules are written in a small language:
+//
+//	sum(category=dining) > 200 in 7d          spent in any 7 days in a row
+//	amount(category=shopping) > 500           any single transaction this month
+//	count(merchant~uber and tag=work) >= 10 in 2w
+//
+// sum totals the matching expenses, count counts them and amount checks each
+// one. Filters match category (including subcategories), tag or merchant
+// (the transaction description); = is an exact match and ~ a substring, both
+// ignoring case. Values with spaces or symbols can be quoted. Without "in",
+// the window is the current month; with it, every window of that many days
+// ending this month is checked. A rule fires at most once a month.
+const alertRulesNamespace = "alert-rules"
+
+const (
+	maxAlertRules          = 50
+	maxRuleExpressionChars = 200
+	maxRuleWindowDays      = 366
+	maxRuleMatches         = 20 // matching transactions attached to an alert
+)
+
+// Alert kind for a triggered custom rule
+const alertRule = "rule"
+
+var (
+	errAlertRuleNotFound = errors.New("alert rule not found")
+	errTooManyAlertRules = errors.New("alert rule limit reached")
+)
+
+// Serializes read-modify-write cycles on alert rules
+var alertRulesMu sync.Mutex
+
+type AlertRule struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Expression string `json:"expression"`
+	Level      string `json:"level"` // warning (default), critical
+}
+
+// Stored form of one user's rules
+type userAlertRules struct {
+	NextID int         `json:"next_id"`
+	Rules  []AlertRule `json:"rules"`
+}
+
+var ruleAggregates = map[string]bool{"sum": true, "count": true, "amount": true}
+
+var ruleFields = map[string]bool{"category": true, "tag": true, "merchant": true}
+
+var ruleComparators = map[string]bool{">": true, ">=": true, "<": true, "<=": true}
+
+type ruleFilter struct {
+	field string // category, tag, merchant
+	op    string // = or ~
+	value string
+}
+
+// A parsed rule expression
+type ruleCondition struct {
+	aggregate  string // sum, count, amount
+	filters    []ruleFilter
+	comparator string
+	threshold  float64
+	windowDays int // 0 is the current month
+}
+
+type ruleToken struct {
+	kind string // word, string, number, symbol
+	text string
+	pos  int // 1-based
+}
+
+func isRuleSymbol(c byte) bool {
+	return strings.IndexByte("(),=~<>", c) >= 0
+}
+
+func tokenizeRule(expression string) ([]ruleToken, error) {
+	var tokens []ruleToken
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expression[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote at position %d", i+1)
+			}
+			tokens = append(tokens, ruleToken{kind: "string", text: expression[i+1 : i+1+end], pos: i + 1})
+			i += end + 2
+		case isRuleSymbol(c):
+			text := string(c)
+			if (c == '>' || c == '<') && i+1 < len(expression) && expression[i+1] == '=' {
+				text += "="
+			}
+			tokens = append(tokens, ruleToken{kind: "symbol", text: text, pos: i + 1})
+			i += len(text)
+		default:
+			start := i
+			for i < len(expression) && !isRuleSymbol(expression[i]) && !strings.ContainsRune(" \t\n\r\"'", rune(expression[i])) {
+				i++
+			}
+			kind := "word"
+			if _, err := strconv.ParseFloat(expression[start:i], 64); err == nil {
+				kind = "number"
+			}
+			tokens = append(tokens, ruleToken{kind: kind, text: expression[start:i], pos: start + 1})
+		}
+	}
+	return tokens, nil
+}
+
+type ruleParser struct {
+	tokens []ruleToken
+	next   int
+	length int
+}
+
+func (p *ruleParser) peek() (ruleToken, bool) {
+	if p.next >= len(p.tokens) {
+		return ruleToken{}, false
+	}
+	return p.tokens[p.next], true
+}
+
+// The next token, or an error naming what was expected instead
+func (p *ruleParser) take(expected string, accept func(ruleToken) bool) (ruleToken, error) {
+	token, ok := p.peek()
+	if !ok {
+		return token, fmt.Errorf("expected %s at position %d, found end of rule", expected, p.length+1)
+	}
+	if !accept(token) {
+		return token, fmt.Errorf("expected %s at position %d, found %q", expected, token.pos, token.text)
+	}
+	p.next++
+	return token, nil
+}
+
+func isSymbol(text string) func(ruleToken) bool {
+	return func(token ruleToken) bool { return token.kind == "symbol" && token.text == text }
+}
+
+func isValue(token ruleToken) bool {
+	return token.kind != "symbol"
+}
+
+// Parses a rule expression, see the grammar at the top of this file
+func parseRule(expression string) (ruleCondition, error) {
+	var condition ruleCondition
+	tokens, err := tokenizeRule(expression)
+	if err != nil {
+		return condition, err
+	}
+	p := &ruleParser{tokens: tokens, length: len(expression)}
+
+	aggregate, err := p.take("sum, count or amount", func(token ruleToken) bool {
+		return token.kind == "word" && ruleAggregates[strings.ToLower(token.text)]
+	})
+	if err != nil {
+		return condition, err
+	}
+	condition.aggregate = strings.ToLower(aggregate.text)
+
+	if _, err := p.take("(", isSymbol("(")); err != nil {
+		return condition, err
+	}
+	if token, ok := p.peek(); !ok || !isSymbol(")")(token) {
+		for {
+			field, err := p.take("category, tag or merchant", func(token ruleToken) bool {
+				return token.kind == "word" && ruleFields[strings.ToLower(token.text)]
+			})
+			if err != nil {
+				return condition, err
+			}
+			op, err := p.take("= or ~", func(token ruleToken) bool { return isSymbol("=")(token) || isSymbol("~")(token) })
+			if err != nil {
+				return condition, err
+			}
+			value, err := p.take("a value", isValue)
+			if err != nil {
+				return condition, err
+			}
+			if strings.TrimSpace(value.text) == "" {
+				return condition, fmt.Errorf("empty value at position %d", value.pos)
+			}
+			condition.filters = append(condition.filters, ruleFilter{field: strings.ToLower(field.text), op: op.text, value: strings.TrimSpace(value.text)})
+
+			token, ok := p.peek()
+			if ok && (isSymbol(",")(token) || (token.kind == "word" && strings.EqualFold(token.text, "and"))) {
+				p.next++
+				continue
+			}
+			break
+		}
+	}
+	if _, err := p.take(")", isSymbol(")")); err != nil {
+		return condition, err
+	}
+
+	comparator, err := p.take(">, >=, < or <=", func(token ruleToken) bool {
+		return token.kind == "symbol" && ruleComparators[token.text]
+	})
+	if err != nil {
+		return condition, err
+	}
+	condition.comparator = comparator.text
+
+	threshold, err := p.take("a number", func(token ruleToken) bool { return token.kind == "number" })
+	if err != nil {
+		return condition, err
+	}
+	condition.threshold, _ = strconv.ParseFloat(threshold.text, 64)
+	if condition.threshold < 0 || math.IsInf(condition.threshold, 0) || math.IsNaN(condition.threshold) {
+		return condition, fmt.Errorf("threshold at position %d must be a non-negative number", threshold.pos)
+	}
+
+	if token, ok := p.peek(); ok && token.kind == "word" && strings.EqualFold(token.text, "in") {
+		p.next++
+		window, err := p.take("a window such as 7d or 2w", func(token ruleToken) bool { return token.kind == "word" })
+		if err != nil {
+			return condition, err
+		}
+		if condition.windowDays, err = parseRuleWindow(window.text); err != nil {
+			return condition, fmt.Errorf("window at position %d %v", window.pos, err)
+		}
+	}
+
+	if token, ok := p.peek(); ok {
+		return condition, fmt.Errorf("unexpected %q at position %d", token.text, token.pos)
+	}
+	return condition, nil
+}
+
+// Window length in days from e.g. "7d" or "2w"
+func parseRuleWindow(text string) (int, error) {
+	text = strings.ToLower(text)
+	unit := 1
+	switch {
+	case strings.HasSuffix(text, "d"):
+	case strings.HasSuffix(text, "w"):
+		unit = 7
+	default:
+		return 0, errors.New("must be a number of days (d) or weeks (w)")
+	}
+	count, err := strconv.Atoi(text[:len(text)-1])
+	if err != nil || count <= 0 || count*unit > maxRuleWindowDays {
+		return 0, fmt.Errorf("must be between 1 and %d days", maxRuleWindowDays)
+	}
+	return count * unit, nil
+}
+
+func (f ruleFilter) matches(transaction Transaction) bool {
+	var candidates []string
+	switch f.field {
+	case "category":
+		if f.op == "=" {
+			return categoryWithin(categoryPath(transaction.Category), canonicalCategory(f.value))
+		}
+		candidates = []string{transaction.Category}
+	case "tag":
+		candidates = transaction.Tags
+	case "merchant":
+		candidates = []string{transaction.Description}
+	}
+
+	for _, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if f.op == "=" && strings.EqualFold(candidate, f.value) {
+			return true
+		}
+		if f.op == "~" && strings.Contains(strings.ToLower(candidate), strings.ToLower(f.value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c ruleCondition) compare(value float64) bool {
+	switch c.comparator {
+	case ">":
+		return value > c.threshold
+	case ">=":
+		return value >= c.threshold
+	case "<":
+		return value < c.threshold
+	default:
+		return value <= c.threshold
+	}
+}
+
+// The windows a rule checks: the current month, or every windowDays-long
+// window ending on a day of the current month up to today
+func (c ruleCondition) windows(now time.Time) []budgetWindow {
+	month := periodWindow("monthly", now, time.Monday)
+	if c.windowDays == 0 {
+		return []budgetWindow{month}
+	}
+	today := periodWindow("daily", now, time.Monday)
+	var windows []budgetWindow
+	for end := month.Start; !end.After(today.Start); end = end.AddDate(0, 0, 1) {
+		windows = append(windows, budgetWindow{Start: end.AddDate(0, 0, 1-c.windowDays), End: end.AddDate(0, 0, 1)})
+	}
+	return windows
+}
+
+// Whether value is further past the threshold than best, so the window that
+// breaches a rule the most is the one reported
+func (c ruleCondition) worse(value, best float64) bool {
+	if c.comparator == "<" || c.comparator == "<=" {
+		return value <= best
+	}
+	return value >= best
+}
+
+func (c ruleCondition) windowText(window budgetWindow) string {
+	last := window.End.AddDate(0, 0, -1).Format("2006-01-02")
+	switch {
+	case c.windowDays == 0:
+		return "this month"
+	case c.aggregate == "amount":
+		// amount rules check the span of every window together, which
+		// reaches back before the month
+		return "since " + window.Start.Format("2006-01-02")
+	case c.windowDays == 1:
+		return "on " + last
+	}
+	return fmt.Sprintf("in the %d days to %s", c.windowDays, last)
+}
+
+// The expenses in window that pass a rule's filters and, for amount rules,
+// its comparison
+func (c ruleCondition) matching(transactions []Transaction, window budgetWindow) []Transaction {
+	var matches []Transaction
+	for _, transaction := range transactions {
+		if transaction.Type != "expense" {
+			continue
+		}
+		at, err := parseTransactionDate(transaction.Date)
+		if err != nil || !window.contains(at) {
+			continue
+		}
+		matched := true
+		for _, filter := range c.filters {
+			if !filter.matches(transaction) {
+				matched = false
+				break
+			}
+		}
+		if !matched || (c.aggregate == "amount" && !c.compare(transaction.Amount)) {
+			continue
+		}
+		matches = append(matches, transaction)
+	}
+	return matches
+}
+
+// Evaluates one rule against the transactions, returning an alert when it
+// is triggered. The alert is keyed on the rule and the month, so a breach
+// keeps its ID while rolling windows move day by day.
+func evaluateAlertRule(rule AlertRule, transactions []Transaction, now time.Time) (Alert, bool) {
+	condition, err := parseRule(rule.Expression)
+	if err != nil {
+		return Alert{}, false
+	}
+	windows := condition.windows(now)
+
+	// amount rules look at each transaction, so every window together is
+	// just the span they cover
+	if condition.aggregate == "amount" {
+		windows = []budgetWindow{{Start: windows[0].Start, End: windows[len(windows)-1].End}}
+	}
+
+	var window budgetWindow
+	var matches []Transaction
+	var total, best float64
+	triggered := false
+	for _, candidate := range windows {
+		candidateMatches := condition.matching(transactions, candidate)
+		candidateTotal := 0.0
+		for _, transaction := range candidateMatches {
+			candidateTotal += transaction.Amount
+		}
+
+		value, breached := candidateTotal, len(candidateMatches) > 0
+		switch condition.aggregate {
+		case "sum":
+			breached = condition.compare(value)
+		case "count":
+			value = float64(len(candidateMatches))
+			breached = condition.compare(value)
+		}
+		if !breached {
+			continue
+		}
+		if !triggered || condition.worse(value, best) {
+			triggered, best = true, value
+			window, matches, total = candidate, candidateMatches, candidateTotal
+		}
+	}
+	if !triggered {
+		return Alert{}, false
+	}
+
+	label := rule.Name
+	if label == "" {
+		label = rule.Expression
+	}
+	noun := "transactions"
+	if len(matches) == 1 {
+		noun = "transaction"
+	}
+
+	month := periodWindow("monthly", now, time.Monday)
+	alert := newAlert(alertRule, fmt.Sprintf("%d|%s", rule.ID, rule.Expression), rule.Level, month.Start.Format("2006-01-02"), now)
+	alert.Category = ""
+	for _, filter := range condition.filters {
+		if filter.field == "category" {
+			alert.Category = filter.value
+			break
+		}
+	}
+	alert.RuleID = rule.ID
+	alert.Rule = rule.Expression
+	alert.Threshold = condition.threshold
+	alert.Amount = math.Round(total*100) / 100
+	switch condition.aggregate {
+	case "sum":
+		alert.Message = fmt.Sprintf("%s: $%.2f spent %s", label, total, condition.windowText(window))
+	case "count":
+		alert.Message = fmt.Sprintf("%s: %d %s %s", label, len(matches), noun, condition.windowText(window))
+	case "amount":
+		alert.Message = fmt.Sprintf("%s: %d %s of %s $%g %s", label, len(matches), noun, condition.comparator, condition.threshold, condition.windowText(window))
+	}
+
+	// Most recent first
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Date > matches[j].Date })
+	if len(matches) > maxRuleMatches {
+		matches = matches[:maxRuleMatches]
+	}
+	alert.Transactions = matches
+	return alert, true
+}
+
+// Alerts for every triggered rule
+func evaluateAlertRules(rules []AlertRule, transactions []Transaction, now time.Time) []Alert {
+	var alerts []Alert
+	for _, rule := range rules {
+		if alert, ok := evaluateAlertRule(rule, transactions, now); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+func validateAlertRule(rule AlertRule) []FieldError {
+	var details []FieldError
+	if len(rule.Name) > maxCategoryLength {
+		details = append(details, FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxCategoryLength)})
+	}
+	switch {
+	case strings.TrimSpace(rule.Expression) == "":
+		details = append(details, FieldError{Field: "expression", Message: "is required"})
+	case len(rule.Expression) > maxRuleExpressionChars:
+		details = append(details, FieldError{Field: "expression", Message: fmt.Sprintf("must be at most %d characters", maxRuleExpressionChars)})
+	default:
+		if _, err := parseRule(rule.Expression); err != nil {
+			details = append(details, FieldError{Field: "expression", Message: err.Error()})
+		}
+	}
+	if rule.Level != alertLevelWarning && rule.Level != alertLevelCritical {
+		details = append(details, FieldError{Field: "level", Message: "must be one of warning, critical"})
+	}
+	return details
+}
+
+func loadAlertRules(userID string) (userAlertRules, error) {
+	doc := userAlertRules{NextID: 1}
+	if _, err := documents.Load(alertRulesNamespace, userID, &doc); err != nil {
+		return doc, wrapAPIError(CodeInternal, "Alert rule storage is unavailable", err)
+	}
+	return doc, nil
+}
+
+// Read-modify-write of a user's rules
+func modifyAlertRules(userID string, change func(doc *userAlertRules) error) error {
+	alertRulesMu.Lock()
+	defer alertRulesMu.Unlock()
+
+	doc, err := loadAlertRules(userID)
+	if err != nil {
+		return err
+	}
+	if err := change(&doc); err != nil {
+		return err
+	}
+	if err := documents.Save(alertRulesNamespace, userID, doc); err != nil {
+		return wrapAPIError(CodeInternal, "Alert rule storage is unavailable", err)
+	}
+	return nil
+}
+
+// Maps alert rule failures onto the error envelope
+func alertRuleError(err error) error {
+	switch {
+	case errors.Is(err, errAlertRuleNotFound):
+		return newAPIError(CodeNotFound, "Alert rule not found")
+	case errors.Is(err, errTooManyAlertRules):
+		return validationError([]FieldError{{Field: "rules", Message: fmt.Sprintf("must contain at most %d rules", maxAlertRules)}})
+	}
+	return err
+}
+
+// CRUD for the authenticated user's custom alert rules:
+//
+//	GET    ?action=rules         list
+//	POST   ?action=rules         create, {"name": "...", "expression": "sum(category=dining) > 200 in 7d"}
+//	PUT    ?action=rules&id=N    replace
+//	DELETE ?action=rules&id=N    delete
+func handleAlertRules(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, _, err := requireAuth(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	var id int
+	if r.Method == "PUT" || r.Method == "DELETE" {
+		id, err = strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || id <= 0 {
+			writeError(w, requestID, validationError([]FieldError{{Field: "id", Message: "must be a positive rule id"}}))
+			return
+		}
+	}
+
+	var result interface{}
+	status := http.StatusOK
+
+	switch r.Method {
+	case "GET":
+		doc, loadErr := loadAlertRules(userID)
+		if loadErr != nil {
+			writeError(w, requestID, loadErr)
+			return
+		}
+		if doc.Rules == nil {
+			doc.Rules = []AlertRule{}
+		}
+		result = doc.Rules
+
+	case "POST", "PUT":
+		var rule AlertRule
+		hasBody, decodeErr := decodeJSONBody(w, r, &rule)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+		rule.Name = strings.TrimSpace(rule.Name)
+		rule.Expression = strings.TrimSpace(rule.Expression)
+		if rule.Level == "" {
+			rule.Level = alertLevelWarning
+		}
+		if details := validateAlertRule(rule); len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+
+		saveErr := modifyAlertRules(userID, func(doc *userAlertRules) error {
+			if r.Method == "POST" {
+				if len(doc.Rules) >= maxAlertRules {
+					return errTooManyAlertRules
+				}
+				rule.ID = doc.NextID
+				doc.NextID++
+				doc.Rules = append(doc.Rules, rule)
+				return nil
+			}
+			for i := range doc.Rules {
+				if doc.Rules[i].ID == id {
+					rule.ID = id
+					doc.Rules[i] = rule
+					return nil
+				}
+			}
+			return errAlertRuleNotFound
+		})
+		if saveErr != nil {
+			writeError(w, requestID, alertRuleError(saveErr))
+			return
+		}
+		if r.Method == "POST" {
+			status = http.StatusCreated
+		}
+		result = rule
+
+	case "DELETE":
+		deleteErr := modifyAlertRules(userID, func(doc *userAlertRules) error {
+			for i := range doc.Rules {
+				if doc.Rules[i].ID == id {
+					doc.Rules = append(doc.Rules[:i], doc.Rules[i+1:]...)
+					return nil
+				}
+			}
+			return errAlertRuleNotFound
+		})
+		if deleteErr != nil {
+			writeError(w, requestID, alertRuleError(deleteErr))
+			return
+		}
+		result = map[string]interface{}{"id": id, "deleted": true}
+
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	// Rules feed the analysis alerts, so any change invalidates it
+	if r.Method != "GET" {
+		userAnalyses.invalidate(userID)
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"data":        result,
+		"computed_at": time.Now().Unix(),
+		"function":    "budget-analyzer",
+		"runtime":     "Go",
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       ruleCondition
+	}{
+		{
+			"sum(category=dining) > 200 in 7d",
+			ruleCondition{aggregate: "sum", filters: []ruleFilter{{"category", "=", "dining"}}, comparator: ">", threshold: 200, windowDays: 7},
+		},
+		{
+			"COUNT(merchant~uber and tag=work) >= 10 in 2W",
+			ruleCondition{aggregate: "count", filters: []ruleFilter{{"merchant", "~", "uber"}, {"tag", "=", "work"}}, comparator: ">=", threshold: 10, windowDays: 14},
+		},
+		{
+			`amount(category="Food > Dining", tag='big spend') <= 0.5`,
+			ruleCondition{aggregate: "amount", filters: []ruleFilter{{"category", "=", "Food > Dining"}, {"tag", "=", "big spend"}}, comparator: "<=", threshold: 0.5},
+		},
+		{
+			"count() < 3 in 1d",
+			ruleCondition{aggregate: "count", comparator: "<", threshold: 3, windowDays: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRule(tt.expression)
+		if err != nil {
+			t.Errorf("parseRule(%q) failed: %v", tt.expression, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRule(%q) = %+v, want %+v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"", "expected sum, count or amount at position 1, found end of rule"},
+		{"total(category=dining) > 5", `expected sum, count or amount at position 1, found "total"`},
+		{"sum category=dining > 5", `expected ( at position 5, found "category"`},
+		{"sum(color=red) > 5", `expected category, tag or merchant at position 5, found "color"`},
+		{"sum(category dining) > 5", `expected = or ~ at position 14, found "dining"`},
+		{"sum(category=) > 5", `expected a value at position 14, found ")"`},
+		{`sum(category="  ") > 5`, "empty value at position 14"},
+		{`sum(category="dining) > 5`, "unterminated quote at position 14"},
+		{"sum(category=dining > 5", `expected ) at position 21, found ">"`},
+		{"sum(category=dining) = 5", `expected >, >=, < or <= at position 22, found "="`},
+		{"sum(category=dining) > lots", `expected a number at position 24, found "lots"`},
+		{"sum(category=dining) > -5", "threshold at position 24 must be a non-negative number"},
+		{"sum(category=dining) > inf", "threshold at position 24 must be a non-negative number"},
+		{"sum(category=dining) > 5 in", "expected a window such as 7d or 2w at position 28, found end of rule"},
+		{"sum(category=dining) > 5 in 7x", "window at position 29 must be a number of days (d) or weeks (w)"},
+		{"sum(category=dining) > 5 in 0d", "window at position 29 must be between 1 and 366 days"},
+		{"sum(category=dining) > 5 in 53w", "window at position 29 must be between 1 and 366 days"},
+		{"sum(category=dining) > 5 weekly", `unexpected "weekly" at position 26`},
+	}
+
+	for _, tt := range tests {
+		_, err := parseRule(tt.expression)
+		if err == nil {
+			t.Errorf("parseRule(%q) succeeded, want %q", tt.expression, tt.want)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("parseRule(%q) error = %q, want %q", tt.expression, err, tt.want)
+		}
+	}
+}
+
+func TestRuleFilterMatches(t *testing.T) {
+	transaction := Transaction{Category: "Food > Dining", Tags: []string{"Work "}, Description: "UBER *TRIP"}
+
+	tests := []struct {
+		filter ruleFilter
+		want   bool
+	}{
+		{ruleFilter{"category", "=", "food"}, true},
+		{ruleFilter{"category", "=", "food > dining"}, true},
+		{ruleFilter{"category", "=", "dining"}, false},
+		{ruleFilter{"category", "~", "din"}, true},
+		{ruleFilter{"tag", "=", "work"}, true},
+		{ruleFilter{"tag", "=", "wor"}, false},
+		{ruleFilter{"merchant", "~", "uber"}, true},
+		{ruleFilter{"merchant", "=", "uber"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.matches(transaction); got != tt.want {
+			t.Errorf("%+v matches = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateAlertRule(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	transactions := []Transaction{
+		{Category: "Dining", Amount: 60, Date: "2026-09-28", Type: "expense"},
+		{Category: "Dining", Amount: 60, Date: "2026-10-02", Type: "expense"},
+		{Category: "Dining", Amount: 60, Date: "2026-10-05", Type: "expense"},
+		{Category: "Dining", Amount: 30, Date: "2026-10-15", Type: "expense"},
+		{Category: "Dining", Amount: 500, Date: "2026-10-16", Type: "income"},
+		{Category: "Shopping", Amount: 700, Date: "2026-09-30", Type: "expense"},
+		{Category: "Shopping", Amount: 600, Date: "2026-10-10", Type: "expense"},
+		{Category: "Shopping", Amount: 200, Date: "2026-10-11", Type: "expense"},
+	}
+
+	tests := []struct {
+		name      string
+		rule      AlertRule
+		triggered bool
+		amount    float64
+		matches   int
+		message   string
+	}{
+		{
+			name:      "rolling sum reports the latest of the worst windows",
+			rule:      AlertRule{ID: 1, Name: "Dining out", Expression: "sum(category=dining) > 100 in 7d", Level: "warning"},
+			triggered: true,
+			amount:    120,
+			matches:   2,
+			message:   "Dining out: $120.00 spent in the 7 days to 2026-10-08",
+		},
+		{
+			name:      "month sum",
+			rule:      AlertRule{ID: 2, Expression: "sum(category=dining) >= 150", Level: "warning"},
+			triggered: true,
+			amount:    150,
+			matches:   3,
+			message:   "sum(category=dining) >= 150: $150.00 spent this month",
+		},
+		{
+			name:      "amount checks each transaction this month",
+			rule:      AlertRule{ID: 3, Expression: "amount(category=shopping) > 500", Level: "critical"},
+			triggered: true,
+			amount:    600,
+			matches:   1,
+			message:   "amount(category=shopping) > 500: 1 transaction of > $500 this month",
+		},
+		{
+			name:      "amount with a window reaches back before the month",
+			rule:      AlertRule{ID: 4, Expression: "amount(category=shopping) > 500 in 30d", Level: "warning"},
+			triggered: true,
+			amount:    1300,
+			matches:   2,
+			message:   "amount(category=shopping) > 500 in 30d: 2 transactions of > $500 since 2026-09-02",
+		},
+		{
+			name: "count below its threshold",
+			rule: AlertRule{ID: 5, Expression: "count(category=dining) >= 4", Level: "warning"},
+		},
+		{
+			name: "an invalid expression never fires",
+			rule: AlertRule{ID: 6, Expression: "sum(category=dining) >", Level: "warning"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert, triggered := evaluateAlertRule(tt.rule, transactions, now)
+			if triggered != tt.triggered {
+				t.Fatalf("triggered = %v, want %v", triggered, tt.triggered)
+			}
+			if !triggered {
+				return
+			}
+			if alert.Amount != tt.amount || len(alert.Transactions) != tt.matches || alert.Message != tt.message {
+				t.Errorf("amount, matches, message = %v, %d, %q; want %v, %d, %q", alert.Amount, len(alert.Transactions), alert.Message, tt.amount, tt.matches, tt.message)
+			}
+			if alert.Kind != alertRule || alert.RuleID != tt.rule.ID || alert.Level != tt.rule.Level || alert.PeriodStart != "2026-10-01" {
+				t.Errorf("alert = %+v", alert)
+			}
+
+			// The ID is keyed on the month, not the window, so it survives
+			// the window moving on a day
+			if later, ok := evaluateAlertRule(tt.rule, transactions, now.AddDate(0, 0, 1)); !ok || later.ID != alert.ID {
+				t.Errorf("alert ID changed from %s to %s (triggered %v) a day later", alert.ID, later.ID, ok)
+			}
+		})
+	}
+}
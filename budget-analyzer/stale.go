@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const lastGoodNamespace = "last-good-analyses"
+
+// LastGoodAnalysis is the most recent current-period budget analysis
+// successfully computed for a user, served with `stale: true` while
+// transaction-api is unavailable to requests for the same view
+type LastGoodAnalysis struct {
+	Analysis         OverallBudgetHealth `json:"analysis"`
+	Budgets          []Budget            `json:"budgets"`
+	TransactionCount int                 `json:"transaction_count"`
+	ComputedAt       time.Time           `json:"computed_at"`
+	View             string              `json:"view"` // see lastGoodView
+}
+
+// Identifies the options a last good analysis was computed with, other than
+// the date: a request with other settings, generation options or week start
+// would have been answered differently
+func lastGoodView(opts analysisOptions, genOpts generationOptions) string {
+	return opts.view() + "|" + genOpts.variant()
+}
+
+func saveLastGood(userID string, result LastGoodAnalysis) {
+	if err := documents.Save(lastGoodNamespace, userID, result); err != nil {
+		log.Printf("budget-analyzer: failed to persist last good analysis: %v", err)
+	}
+}
+
+// Loads the last good analysis if it was computed for the given view
+func loadLastGood(userID, view string) (LastGoodAnalysis, bool) {
+	var result LastGoodAnalysis
+	found, err := documents.Load(lastGoodNamespace, userID, &result)
+	if err != nil {
+		log.Printf("budget-analyzer: failed to load last good analysis: %v", err)
+		return LastGoodAnalysis{}, false
+	}
+	return result, found && result.View == view
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Limits on POSTed analysis payloads. The body limit follows from the count
+// limits, so a payload that is too large reports which count it exceeds
+// rather than its size.
+const (
+	maxBudgets              = 100
+	maxTransactions         = 10000
+	maxCategoryLength       = 100
+	maxBudgetJSONBytes      = 1 << 10 // generous for one budget object
+	maxTransactionJSONBytes = 1 << 10 // generous for one transaction object, tags included
+
+	// ~10 MiB, plus room for the rest of the envelope
+	maxRequestBodyBytes = maxBudgets*maxBudgetJSONBytes + maxTransactions*maxTransactionJSONBytes + 64<<10
+
+	// Every other body is a single budget, rule, endpoint, setting or
+	// envelope move, or at most maxBudgets bucket mappings
+	maxSmallRequestBodyBytes = 64 << 10 // 64 KiB
+)
+
+var validPeriods = map[string]bool{"monthly": true, "weekly": true, "daily": true}
+
+var validTransactionTypes = map[string]bool{"income": true, "expense": true}
+
+// Transaction date layouts accepted from transaction-api and from clients
+var transactionDateLayouts = []string{
+	"2006-01-02T15:04:05.000Z",
+	time.RFC3339Nano,
+	"2006-01-02",
+}
+
+func parseTransactionDate(value string) (time.Time, error) {
+	for _, layout := range transactionDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+// Body of a POST analysis request
+type budgetRequest struct {
+	Budgets      []Budget      `json:"budgets"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+func validationError(details []FieldError) *APIError {
+	err := newAPIError(CodeValidationFailed, "Request validation failed")
+	err.Details = details
+	return err
+}
+
+// decodeJSONBody strictly decodes a single JSON object of at most
+// maxSmallRequestBodyBytes from the request body: unknown fields, trailing
+// data and oversized bodies are rejected. An empty body reports false without
+// error so callers can decide whether it's allowed.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) (bool, error) {
+	return decodeJSONBodyLimit(w, r, v, maxSmallRequestBodyBytes)
+}
+
+// decodeJSONBody with a body limit of its own, for analysis payloads
+func decodeJSONBodyLimit(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) (bool, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, validationError([]FieldError{decodeFieldError(err)})
+	}
+
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return false, validationError([]FieldError{{Field: "body", Message: "must contain a single JSON object"}})
+	}
+
+	return true, nil
+}
+
+// Translates a json decoding failure into the field it concerns
+func decodeFieldError(err error) FieldError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &sizeErr):
+		return FieldError{Field: "body", Message: fmt.Sprintf("must not exceed %d bytes", sizeErr.Limit)}
+	case errors.As(err, &syntaxErr):
+		return FieldError{Field: "body", Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		return FieldError{Field: typeErr.Field, Message: "has the wrong type (got " + typeErr.Value + ")"}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return FieldError{Field: strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`), Message: "is not a recognized field"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return FieldError{Field: "body", Message: "malformed JSON: unexpected end of input"}
+	}
+	return FieldError{Field: "body", Message: "must be a valid JSON object"}
+}
+
+func validateBudgets(budgets []Budget) []FieldError {
+	var details []FieldError
+
+	if len(budgets) > maxBudgets {
+		details = append(details, FieldError{Field: "budgets", Message: fmt.Sprintf("must contain at most %d budgets", maxBudgets)})
+		return details
+	}
+
+	seen := make(map[string]int)
+	for i, budget := range budgets {
+		field := fmt.Sprintf("budgets[%d]", i)
+		details = append(details, validateBudget(field+".", budget)...)
+
+		if key := strings.ToLower(canonicalCategory(budget.Category)); key != "" {
+			if first, dup := seen[key]; dup {
+				details = append(details, FieldError{Field: field + ".category", Message: fmt.Sprintf("duplicates budgets[%d].category", first)})
+			} else {
+				seen[key] = i
+			}
+		}
+	}
+
+	return details
+}
+
+// Validates a single budget; prefix is prepended to field names
+func validateBudget(prefix string, budget Budget) []FieldError {
+	var details []FieldError
+
+	category := strings.TrimSpace(budget.Category)
+	if category == "" {
+		details = append(details, FieldError{Field: prefix + "category", Message: "is required"})
+	} else if len(category) > maxCategoryLength {
+		details = append(details, FieldError{Field: prefix + "category", Message: fmt.Sprintf("must be at most %d characters", maxCategoryLength)})
+	}
+
+	if budget.Amount <= 0 {
+		details = append(details, FieldError{Field: prefix + "amount", Message: "must be greater than 0"})
+	}
+
+	if !validPeriods[budget.Period] {
+		details = append(details, FieldError{Field: prefix + "period", Message: "must be one of monthly, weekly, daily"})
+	}
+
+	if budget.RolloverCap < 0 {
+		details = append(details, FieldError{Field: prefix + "rollover_cap", Message: "must not be negative"})
+	} else if budget.RolloverCap > 0 && !budget.Rollover {
+		details = append(details, FieldError{Field: prefix + "rollover_cap", Message: "requires rollover to be enabled"})
+	}
+
+	if budget.RolloverFrom != "" {
+		if _, err := time.Parse("2006-01-02", budget.RolloverFrom); err != nil {
+			details = append(details, FieldError{Field: prefix + "rollover_from", Message: "must be a date in YYYY-MM-DD format"})
+		} else if !budget.Rollover {
+			details = append(details, FieldError{Field: prefix + "rollover_from", Message: "requires rollover to be enabled"})
+		}
+	}
+
+	details = append(details, validateThresholdPair(prefix+"warning_threshold", budget.WarningThreshold, prefix+"critical_threshold", budget.CriticalThreshold, true)...)
+
+	return details
+}
+
+func validateTransactions(transactions []Transaction) []FieldError {
+	var details []FieldError
+
+	if len(transactions) > maxTransactions {
+		details = append(details, FieldError{Field: "transactions", Message: fmt.Sprintf("must contain at most %d transactions", maxTransactions)})
+		return details
+	}
+
+	for i, transaction := range transactions {
+		field := fmt.Sprintf("transactions[%d]", i)
+
+		if transaction.Amount <= 0 {
+			details = append(details, FieldError{Field: field + ".amount", Message: "must be greater than 0"})
+		}
+
+		if !validTransactionTypes[transaction.Type] {
+			details = append(details, FieldError{Field: field + ".type", Message: "must be one of income, expense"})
+		}
+
+		if transaction.Type == "expense" && strings.TrimSpace(transaction.Category) == "" {
+			details = append(details, FieldError{Field: field + ".category", Message: "is required for expenses"})
+		}
+
+		if _, err := parseTransactionDate(transaction.Date); err != nil {
+			details = append(details, FieldError{Field: field + ".date", Message: "must be an ISO 8601 date (YYYY-MM-DD or RFC 3339)"})
+		}
+	}
+
+	return details
+}
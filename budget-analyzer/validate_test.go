@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONBody(t *testing.T) {
+	large := `{"category":"` + strings.Repeat("x", maxSmallRequestBodyBytes) + `"}`
+
+	tests := []struct {
+		name    string
+		body    string
+		limit   int64
+		hasBody bool
+		message string // of the body or field error
+	}{
+		{"object", `{"category":"Food","amount":12.5}`, maxSmallRequestBodyBytes, true, ""},
+		{"empty", "", maxSmallRequestBodyBytes, false, ""},
+		{"unknown field", `{"categry":"Food"}`, maxSmallRequestBodyBytes, false, "is not a recognized field"},
+		{"trailing data", `{"category":"Food"} {}`, maxSmallRequestBodyBytes, false, "must contain a single JSON object"},
+		{"malformed", `{"category":`, maxSmallRequestBodyBytes, false, "malformed JSON"},
+		{"over the small limit", large, maxSmallRequestBodyBytes, false, "must not exceed 65536 bytes"},
+		{"within an analysis limit", large, maxRequestBodyBytes, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var budget Budget
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			hasBody, err := decodeJSONBodyLimit(httptest.NewRecorder(), r, &budget, tt.limit)
+
+			if hasBody != tt.hasBody {
+				t.Errorf("hasBody = %v, want %v", hasBody, tt.hasBody)
+			}
+			if tt.message == "" {
+				if err != nil {
+					t.Errorf("err = %v, want none", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || len(apiErr.Details) != 1 || !strings.Contains(apiErr.Details[0].Message, tt.message) {
+				t.Errorf("err = %+v, want a validation error containing %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestSmallEndpointsRejectLargeBodies(t *testing.T) {
+	newTestServices(t, "body-limit-user", nil)
+	body := `{"name":"` + strings.Repeat("x", maxSmallRequestBodyBytes) + `"}`
+
+	for _, action := range []string{"alert-settings", "rules", "webhooks", "envelopes", "budgets"} {
+		method := "POST"
+		if action == "alert-settings" {
+			method = "PUT"
+		}
+		r := httptest.NewRequest(method, "/?action="+action, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer token-"+t.Name())
+		w := httptest.NewRecorder()
+		BudgetAnalyzerHandler(w, r)
+
+		if w.Code != 400 || !strings.Contains(w.Body.String(), "must not exceed 65536 bytes") {
+			t.Errorf("%s %s: status %d, body %s", method, action, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestValidateBudgets(t *testing.T) {
+	valid := Budget{Category: "Dining", Amount: 200, Period: "monthly"}
+
+	tests := []struct {
+		name   string
+		change func(budget *Budget)
+		fields []string
+	}{
+		{"valid", func(budget *Budget) {}, nil},
+		{"missing category", func(budget *Budget) { budget.Category = " " }, []string{"budgets[0].category"}},
+		{"long category", func(budget *Budget) { budget.Category = strings.Repeat("x", maxCategoryLength+1) }, []string{"budgets[0].category"}},
+		{"zero amount", func(budget *Budget) { budget.Amount = 0 }, []string{"budgets[0].amount"}},
+		{"unknown period", func(budget *Budget) { budget.Period = "yearly" }, []string{"budgets[0].period"}},
+		{"cap without rollover", func(budget *Budget) { budget.RolloverCap = 50 }, []string{"budgets[0].rollover_cap"}},
+		{"negative cap", func(budget *Budget) { budget.Rollover, budget.RolloverCap = true, -1 }, []string{"budgets[0].rollover_cap"}},
+		{"bad rollover start", func(budget *Budget) { budget.Rollover, budget.RolloverFrom = true, "October" }, []string{"budgets[0].rollover_from"}},
+		{"rollover start without rollover", func(budget *Budget) { budget.RolloverFrom = "2026-10-01" }, []string{"budgets[0].rollover_from"}},
+		{"warning above critical", func(budget *Budget) { budget.WarningThreshold, budget.CriticalThreshold = 95, 90 }, []string{"budgets[0].warning_threshold"}},
+	}
+
+	for _, tt := range tests {
+		budget := valid
+		tt.change(&budget)
+
+		var fields []string
+		for _, detail := range validateBudgets([]Budget{budget}) {
+			fields = append(fields, detail.Field)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: invalid fields = %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+
+	duplicates := []Budget{valid, {Category: "dining", Amount: 50, Period: "weekly"}}
+	if details := validateBudgets(duplicates); len(details) != 1 || details[0].Field != "budgets[1].category" {
+		t.Errorf("duplicate categories: %+v", details)
+	}
+	if details := validateBudgets(make([]Budget, maxBudgets+1)); len(details) != 1 || details[0].Field != "budgets" {
+		t.Errorf("too many budgets: %+v", details)
+	}
+}
+
+func TestValidateTransactions(t *testing.T) {
+	tests := []struct {
+		name        string
+		transaction Transaction
+		fields      []string
+	}{
+		{"expense", Transaction{Amount: 12, Type: "expense", Category: "Dining", Date: "2026-10-02"}, nil},
+		{"income without category", Transaction{Amount: 1000, Type: "income", Date: "2026-10-01T09:00:00Z"}, nil},
+		{"zero amount", Transaction{Type: "expense", Category: "Dining", Date: "2026-10-02"}, []string{"transactions[0].amount"}},
+		{"unknown type", Transaction{Amount: 12, Type: "refund", Category: "Dining", Date: "2026-10-02"}, []string{"transactions[0].type"}},
+		{"expense without category", Transaction{Amount: 12, Type: "expense", Date: "2026-10-02"}, []string{"transactions[0].category"}},
+		{"bad date", Transaction{Amount: 12, Type: "expense", Category: "Dining", Date: "02/10/2026"}, []string{"transactions[0].date"}},
+	}
+
+	for _, tt := range tests {
+		var fields []string
+		for _, detail := range validateTransactions([]Transaction{tt.transaction}) {
+			fields = append(fields, detail.Field)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: invalid fields = %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+}
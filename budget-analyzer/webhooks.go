@@ -0,0 +1,658 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Alerts are pushed to the user's registered webhook endpoints. Each request
+// is signed with the endpoint's secret:
+//
+//	X-Budget-Timestamp: unix seconds
+//	X-Budget-Signature: sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+//
+// An alert is sent to an endpoint once; its ID fingerprints the condition
+// and period, so refreshing the dashboard doesn't send it again. An endpoint
+// that rejects an alert (4xx) isn't sent it again either; one that is down
+// gets it again after a growing delay, until maxWebhookRetryRounds rounds
+// have failed.
+//
+// Endpoints are user-supplied URLs fetched from inside our network, so they
+// must be https and resolve to public addresses. The address is checked when
+// the endpoint is registered and again on every connection, so a DNS answer
+// that changes afterwards can't point a delivery at an internal host.
+const webhooksNamespace = "webhooks"
+
+const (
+	maxWebhookEndpoints  = 10
+	maxWebhookDeliveries = 100 // most recent deliveries kept in the log
+	maxWebhookAttempts   = 4
+	minWebhookSecretLen  = 16
+	webhookSentRetention = 90 * 24 * time.Hour // how long delivered alert IDs are remembered
+	webhookClaimTTL      = 2 * time.Minute     // after this an unfinished delivery may be tried again
+
+	maxWebhookRetryRounds = 6                // failed rounds before an alert is given up on
+	webhookRetryDelay     = time.Minute      // before the second round, doubling after each
+	maxWebhookRetryDelay  = 30 * time.Minute // cap on the delay between rounds
+)
+
+var (
+	errWebhookNotFound    = errors.New("webhook not found")
+	errTooManyWebhooks    = errors.New("webhook limit reached")
+	errWebhookRejected    = errors.New("endpoint rejected the delivery")
+	errWebhookUnavailable = errors.New("endpoint unavailable")
+	errWebhookBlocked     = errors.New("endpoint address is not public")
+)
+
+// Address blocks that aren't covered by the net.IP predicates but are still
+// not on the public internet
+var nonPublicNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // "this network"
+	mustParseCIDR("100.64.0.0/10"), // carrier-grade NAT
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolves a webhook host, requiring every address it has to be public
+func checkWebhookHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return errWebhookBlocked
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), getWebhookTimeout())
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return errWebhookBlocked
+		}
+	}
+	return nil
+}
+
+// Runs before every connection a delivery makes, on the address actually dialed
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s", errWebhookBlocked, address)
+	}
+	return nil
+}
+
+// A client that only connects to public addresses, directly rather than via
+// any proxy, and doesn't follow redirects
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: webhookDialControl}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Serializes read-modify-write cycles on webhook documents
+var webhooksMu sync.Mutex
+
+// Delivery timing, overridable through the function environment
+func getWebhookTimeout() time.Duration {
+	return envDuration("WEBHOOK_TIMEOUT", 5*time.Second)
+}
+
+func getWebhookRetryBackoff() time.Duration {
+	return envDuration("WEBHOOK_RETRY_BACKOFF", time.Second)
+}
+
+// Total time one background round may spend delivering an analysis' alerts,
+// retries included. Keep it under webhookClaimTTL.
+func getWebhookDeliveryBudget() time.Duration {
+	return envDuration("WEBHOOK_DELIVERY_BUDGET", 30*time.Second)
+}
+
+type WebhookEndpoint struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only returned when the endpoint is created
+	MinLevel  string    `json:"min_level"`        // warning (default) or critical
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// One attempt to hand an alert to an endpoint, after any retries
+type WebhookDelivery struct {
+	ID             string    `json:"id"`
+	EndpointID     int       `json:"endpoint_id"`
+	AlertID        string    `json:"alert_id"`
+	AlertKind      string    `json:"alert_kind"`
+	Status         string    `json:"status"` // delivered, rejected (not retried), failed (retried in a later round)
+	Attempts       int       `json:"attempts"`
+	ResponseStatus int       `json:"response_status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	At             time.Time `json:"at"`
+}
+
+// Body POSTed to an endpoint
+type WebhookPayload struct {
+	ID     string    `json:"id"` // delivery ID, stable across retries
+	Event  string    `json:"event"`
+	UserID string    `json:"user_id"`
+	Alert  Alert     `json:"alert"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// Stored form of one user's webhooks
+type userWebhooks struct {
+	NextID     int                     `json:"next_id"`
+	Endpoints  []WebhookEndpoint       `json:"endpoints"`
+	Sent       map[string]time.Time    `json:"sent"`              // "endpointID|alertID" -> when it was delivered
+	Claims     map[string]time.Time    `json:"claims,omitempty"`  // deliveries in progress -> when they were claimed
+	Retries    map[string]webhookRetry `json:"retries,omitempty"` // failed deliveries waiting for another round
+	Deliveries []WebhookDelivery       `json:"deliveries"`        // oldest first
+}
+
+// Backoff for an alert an endpoint couldn't take
+type webhookRetry struct {
+	Failures int       `json:"failures"` // rounds failed so far
+	NextAt   time.Time `json:"next_at"`
+}
+
+// Delay before the round after the given number of failed rounds
+func webhookRetryDelayAfter(failures int) time.Duration {
+	delay := webhookRetryDelay
+	for i := 1; i < failures && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookRetryDelay {
+		return maxWebhookRetryDelay
+	}
+	return delay
+}
+
+func loadWebhooks(userID string) (userWebhooks, error) {
+	doc := userWebhooks{NextID: 1}
+	if _, err := documents.Load(webhooksNamespace, userID, &doc); err != nil {
+		return doc, wrapAPIError(CodeInternal, "Webhook storage is unavailable", err)
+	}
+	if doc.Sent == nil {
+		doc.Sent = make(map[string]time.Time)
+	}
+	if doc.Claims == nil {
+		doc.Claims = make(map[string]time.Time)
+	}
+	if doc.Retries == nil {
+		doc.Retries = make(map[string]webhookRetry)
+	}
+	return doc, nil
+}
+
+// Read-modify-write of a user's webhooks
+func modifyWebhooks(userID string, change func(doc *userWebhooks) error) error {
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+
+	doc, err := loadWebhooks(userID)
+	if err != nil {
+		return err
+	}
+	if err := change(&doc); err != nil {
+		return err
+	}
+	if err := documents.Save(webhooksNamespace, userID, doc); err != nil {
+		return wrapAPIError(CodeInternal, "Webhook storage is unavailable", err)
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookSentKey(endpointID int, alertID string) string {
+	return strconv.Itoa(endpointID) + "|" + alertID
+}
+
+// Whether an endpoint wants alerts at this level
+func (e WebhookEndpoint) accepts(alert Alert) bool {
+	return e.MinLevel != alertLevelCritical || alert.Level == alertLevelCritical
+}
+
+// Sends one signed request, reporting the response status
+func postWebhook(ctx context.Context, client *http.Client, endpoint WebhookEndpoint, body []byte) (int, error) {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "budget-analyzer-webhooks")
+	req.Header.Set("X-Budget-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Budget-Signature", signWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if errors.Is(err, errWebhookBlocked) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errWebhookUnavailable, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return resp.StatusCode, fmt.Errorf("%w: status %d", errWebhookUnavailable, resp.StatusCode)
+	}
+	return resp.StatusCode, fmt.Errorf("%w: status %d", errWebhookRejected, resp.StatusCode)
+}
+
+// Delivers one alert, retrying network errors, 429s and 5xxs with
+// exponential backoff until ctx's deadline. No attempts means the deadline
+// passed before it could start.
+func deliverWebhook(ctx context.Context, client *http.Client, endpoint WebhookEndpoint, userID string, alert Alert) WebhookDelivery {
+	delivery := WebhookDelivery{EndpointID: endpoint.ID, AlertID: alert.ID, AlertKind: alert.Kind, Status: "failed"}
+	delivery.ID, _ = randomHex(8)
+
+	body, err := json.Marshal(WebhookPayload{ID: delivery.ID, Event: "budget.alert", UserID: userID, Alert: alert, SentAt: time.Now().UTC()})
+	if err != nil {
+		delivery.Status = "rejected"
+		delivery.Error = err.Error()
+		delivery.Attempts = 1
+		delivery.At = time.Now().UTC()
+		return delivery
+	}
+
+	backoff := getWebhookRetryBackoff()
+	for delivery.Attempts < maxWebhookAttempts && ctx.Err() == nil {
+		if delivery.Attempts > 0 {
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+				break
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		delivery.Attempts++
+
+		delivery.ResponseStatus, err = postWebhook(ctx, client, endpoint, body)
+		if err == nil {
+			delivery.Status = "delivered"
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+		if !errors.Is(err, errWebhookUnavailable) {
+			delivery.Status = "rejected"
+			break
+		}
+	}
+	delivery.At = time.Now().UTC()
+	return delivery
+}
+
+// An alert claimed for delivery to one endpoint
+type webhookClaim struct {
+	endpoint WebhookEndpoint
+	alert    Alert
+}
+
+// Claims the alerts that are due to go to the user's endpoints: not yet
+// sent, not claimed by another round, and not waiting out a retry delay.
+// Claiming before sending keeps concurrent analyses from sending an alert
+// twice.
+func claimWebhookDeliveries(userID string, alerts []Alert, now time.Time) []webhookClaim {
+	var claims []webhookClaim
+	err := modifyWebhooks(userID, func(doc *userWebhooks) error {
+		for key, at := range doc.Sent {
+			if now.Sub(at) > webhookSentRetention {
+				delete(doc.Sent, key)
+			}
+		}
+		for key, at := range doc.Claims {
+			if now.Sub(at) > webhookClaimTTL {
+				delete(doc.Claims, key)
+			}
+		}
+		for key, retry := range doc.Retries {
+			if now.Sub(retry.NextAt) > webhookSentRetention {
+				delete(doc.Retries, key)
+			}
+		}
+		for _, endpoint := range doc.Endpoints {
+			for _, alert := range alerts {
+				key := webhookSentKey(endpoint.ID, alert.ID)
+				_, sent := doc.Sent[key]
+				_, claimed := doc.Claims[key]
+				retry, retrying := doc.Retries[key]
+				if sent || claimed || (retrying && now.Before(retry.NextAt)) || !endpoint.accepts(alert) {
+					continue
+				}
+				doc.Claims[key] = now
+				claims = append(claims, webhookClaim{endpoint, alert})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("budget-analyzer: webhook delivery skipped for %s: %v", userID, err)
+		return nil
+	}
+	return claims
+}
+
+// Delivers claimed alerts one after another until ctx's deadline
+func sendWebhookDeliveries(ctx context.Context, client *http.Client, userID string, claims []webhookClaim) []WebhookDelivery {
+	deliveries := make([]WebhookDelivery, 0, len(claims))
+	for _, claim := range claims {
+		deliveries = append(deliveries, deliverWebhook(ctx, client, claim.endpoint, userID, claim.alert))
+	}
+	return deliveries
+}
+
+// Releases a round's claims and records its outcomes. Delivered and rejected
+// alerts count as sent, so an endpoint answering 4xx isn't sent the alert on
+// every refresh; failed ones wait webhookRetryDelayAfter before another round
+// may try, and count as sent once maxWebhookRetryRounds rounds have failed.
+// Deliveries the round had no time to attempt are simply released.
+func recordWebhookDeliveries(userID string, deliveries []WebhookDelivery) {
+	err := modifyWebhooks(userID, func(doc *userWebhooks) error {
+		for _, delivery := range deliveries {
+			key := webhookSentKey(delivery.EndpointID, delivery.AlertID)
+			delete(doc.Claims, key)
+			if delivery.Attempts == 0 {
+				continue
+			}
+			doc.Deliveries = append(doc.Deliveries, delivery)
+
+			if delivery.Status == "failed" {
+				retry := doc.Retries[key]
+				retry.Failures++
+				if retry.Failures < maxWebhookRetryRounds {
+					retry.NextAt = delivery.At.Add(webhookRetryDelayAfter(retry.Failures))
+					doc.Retries[key] = retry
+					continue
+				}
+			}
+			delete(doc.Retries, key)
+			doc.Sent[key] = delivery.At
+		}
+		if len(doc.Deliveries) > maxWebhookDeliveries {
+			doc.Deliveries = doc.Deliveries[len(doc.Deliveries)-maxWebhookDeliveries:]
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("budget-analyzer: failed to record webhook deliveries for %s: %v", userID, err)
+	}
+}
+
+// Sends an analysis' alerts to the user's webhooks. Alerts are claimed before
+// the response is written and delivered in the background, bounded by the
+// delivery budget, so a slow or failing endpoint never holds up a refresh.
+// If the runtime freezes the function before a round finishes, its claims
+// lapse after webhookClaimTTL and a later analysis sends those alerts.
+func notifyAlertWebhooks(userID string, alerts []Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	claims := claimWebhookDeliveries(userID, alerts, time.Now().UTC())
+	if len(claims) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), getWebhookDeliveryBudget())
+		defer cancel()
+		deliveries := sendWebhookDeliveries(ctx, newWebhookClient(getWebhookTimeout()), userID, claims)
+		recordWebhookDeliveries(userID, deliveries)
+	}()
+}
+
+func validateWebhookEndpoint(endpoint WebhookEndpoint) []FieldError {
+	var details []FieldError
+	parsed, err := url.Parse(endpoint.URL)
+	switch {
+	case err != nil || parsed.Scheme != "https" || parsed.Hostname() == "":
+		details = append(details, FieldError{Field: "url", Message: "must be an absolute https URL"})
+	case len(endpoint.URL) > 2048:
+		details = append(details, FieldError{Field: "url", Message: "must be at most 2048 characters"})
+	default:
+		if err := checkWebhookHost(parsed.Hostname()); errors.Is(err, errWebhookBlocked) {
+			details = append(details, FieldError{Field: "url", Message: "must resolve to a public address"})
+		} else if err != nil {
+			details = append(details, FieldError{Field: "url", Message: "must have a host that resolves"})
+		}
+	}
+	if endpoint.Secret != "" && len(endpoint.Secret) < minWebhookSecretLen {
+		details = append(details, FieldError{Field: "secret", Message: fmt.Sprintf("must be at least %d characters", minWebhookSecretLen)})
+	}
+	if endpoint.MinLevel != alertLevelWarning && endpoint.MinLevel != alertLevelCritical {
+		details = append(details, FieldError{Field: "min_level", Message: "must be one of warning, critical"})
+	}
+	return details
+}
+
+// Maps webhook failures onto the error envelope
+func webhookError(err error) error {
+	switch {
+	case errors.Is(err, errWebhookNotFound):
+		return newAPIError(CodeNotFound, "Webhook not found")
+	case errors.Is(err, errTooManyWebhooks):
+		return validationError([]FieldError{{Field: "webhooks", Message: fmt.Sprintf("must contain at most %d endpoints", maxWebhookEndpoints)}})
+	}
+	return err
+}
+
+// The authenticated user's webhook endpoints:
+//
+//	GET    ?action=webhooks         list, without secrets
+//	POST   ?action=webhooks         register, {"url": "https://...", "secret": "...", "min_level": "critical"}
+//	DELETE ?action=webhooks&id=N    remove
+//
+// A secret is generated when none is given; it is only returned on creation.
+func handleWebhooks(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, _, err := requireAuth(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	var result interface{}
+	status := http.StatusOK
+
+	switch r.Method {
+	case "GET":
+		doc, loadErr := loadWebhooks(userID)
+		if loadErr != nil {
+			writeError(w, requestID, loadErr)
+			return
+		}
+		endpoints := make([]WebhookEndpoint, 0, len(doc.Endpoints))
+		for _, endpoint := range doc.Endpoints {
+			endpoint.Secret = ""
+			endpoints = append(endpoints, endpoint)
+		}
+		result = endpoints
+
+	case "POST":
+		var endpoint WebhookEndpoint
+		hasBody, decodeErr := decodeJSONBody(w, r, &endpoint)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+		endpoint.URL = strings.TrimSpace(endpoint.URL)
+		if endpoint.MinLevel == "" {
+			endpoint.MinLevel = alertLevelWarning
+		}
+		if details := validateWebhookEndpoint(endpoint); len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+		if endpoint.Secret == "" {
+			if endpoint.Secret, err = randomHex(32); err != nil {
+				writeError(w, requestID, wrapAPIError(CodeInternal, "Internal error", err))
+				return
+			}
+		}
+		endpoint.CreatedAt = time.Now().UTC()
+
+		saveErr := modifyWebhooks(userID, func(doc *userWebhooks) error {
+			if len(doc.Endpoints) >= maxWebhookEndpoints {
+				return errTooManyWebhooks
+			}
+			endpoint.ID = doc.NextID
+			doc.NextID++
+			doc.Endpoints = append(doc.Endpoints, endpoint)
+			return nil
+		})
+		if saveErr != nil {
+			writeError(w, requestID, webhookError(saveErr))
+			return
+		}
+		// Recompute on the next refresh so current alerts reach the new endpoint
+		userAnalyses.invalidate(userID)
+		status = http.StatusCreated
+		result = endpoint
+
+	case "DELETE":
+		id, convErr := strconv.Atoi(r.URL.Query().Get("id"))
+		if convErr != nil || id <= 0 {
+			writeError(w, requestID, validationError([]FieldError{{Field: "id", Message: "must be a positive webhook id"}}))
+			return
+		}
+		deleteErr := modifyWebhooks(userID, func(doc *userWebhooks) error {
+			for i := range doc.Endpoints {
+				if doc.Endpoints[i].ID == id {
+					doc.Endpoints = append(doc.Endpoints[:i], doc.Endpoints[i+1:]...)
+					prefix := strconv.Itoa(id) + "|"
+					for _, keys := range []map[string]time.Time{doc.Sent, doc.Claims} {
+						for key := range keys {
+							if strings.HasPrefix(key, prefix) {
+								delete(keys, key)
+							}
+						}
+					}
+					for key := range doc.Retries {
+						if strings.HasPrefix(key, prefix) {
+							delete(doc.Retries, key)
+						}
+					}
+					return nil
+				}
+			}
+			return errWebhookNotFound
+		})
+		if deleteErr != nil {
+			writeError(w, requestID, webhookError(deleteErr))
+			return
+		}
+		result = map[string]interface{}{"id": id, "deleted": true}
+
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"data":        result,
+		"computed_at": time.Now().Unix(),
+		"function":    "budget-analyzer",
+		"runtime":     "Go",
+	})
+}
+
+// The authenticated user's recent webhook deliveries, newest first:
+//
+//	GET ?action=webhook-deliveries
+func handleWebhookDeliveries(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, _, err := requireAuth(r)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	doc, err := loadWebhooks(userID)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	deliveries := append([]WebhookDelivery{}, doc.Deliveries...)
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].At.After(deliveries[j].At) })
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"data":        deliveries,
+		"computed_at": time.Now().Unix(),
+		"function":    "budget-analyzer",
+		"runtime":     "Go",
+	})
+}
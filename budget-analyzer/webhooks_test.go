@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"id":"abc"}`)
+	signature := signWebhook("s3cret-s3cret-s3cret", 1760000000, body)
+
+	// What a receiver computes to verify a delivery
+	mac := hmac.New(sha256.New, []byte("s3cret-s3cret-s3cret"))
+	mac.Write([]byte("1760000000." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("signWebhook = %s, want %s", signature, want)
+	}
+
+	if signWebhook("s3cret-s3cret-s3cret", 1760000001, body) == signature {
+		t.Error("signature doesn't depend on the timestamp")
+	}
+	if signWebhook("another-secret-value", 1760000000, body) == signature {
+		t.Error("signature doesn't depend on the secret")
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // cloud metadata
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		blocked bool
+	}{
+		{"93.184.216.34:443", false},
+		{"127.0.0.1:443", true},
+		{"[::1]:443", true},
+		{"10.0.0.5:8443", true},
+		{"localhost:443", true}, // only resolved addresses are dialed
+	}
+
+	for _, tt := range tests {
+		err := webhookDialControl("tcp", tt.address, nil)
+		if blocked := errors.Is(err, errWebhookBlocked); blocked != tt.blocked {
+			t.Errorf("webhookDialControl(%s) = %v, want blocked %v", tt.address, err, tt.blocked)
+		}
+	}
+}
+
+func TestValidateWebhookEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint WebhookEndpoint
+		want     string // message for url, or the invalid field
+	}{
+		{"public address", WebhookEndpoint{URL: "https://93.184.216.34/hooks", MinLevel: alertLevelWarning}, ""},
+		{"http", WebhookEndpoint{URL: "http://93.184.216.34/hooks", MinLevel: alertLevelWarning}, "must be an absolute https URL"},
+		{"relative", WebhookEndpoint{URL: "/hooks", MinLevel: alertLevelWarning}, "must be an absolute https URL"},
+		{"loopback", WebhookEndpoint{URL: "https://127.0.0.1/hooks", MinLevel: alertLevelWarning}, "must resolve to a public address"},
+		{"metadata", WebhookEndpoint{URL: "https://169.254.169.254/latest", MinLevel: alertLevelWarning}, "must resolve to a public address"},
+		{"ipv6 loopback", WebhookEndpoint{URL: "https://[::1]:8443/hooks", MinLevel: alertLevelWarning}, "must resolve to a public address"},
+		{"short secret", WebhookEndpoint{URL: "https://93.184.216.34/hooks", Secret: "short", MinLevel: alertLevelWarning}, "secret"},
+		{"unknown level", WebhookEndpoint{URL: "https://93.184.216.34/hooks", MinLevel: "info"}, "min_level"},
+	}
+
+	for _, tt := range tests {
+		details := validateWebhookEndpoint(tt.endpoint)
+		got := ""
+		if len(details) > 0 {
+			got = details[0].Field
+			if got == "url" {
+				got = details[0].Message
+			}
+		}
+		if len(details) > 1 || got != tt.want {
+			t.Errorf("%s: validateWebhookEndpoint = %+v, want %q", tt.name, details, tt.want)
+		}
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNoContent, nil},
+		{http.StatusBadRequest, errWebhookRejected},
+		{http.StatusGone, errWebhookRejected},
+		{http.StatusTooManyRequests, errWebhookUnavailable},
+		{http.StatusBadGateway, errWebhookUnavailable},
+		{http.StatusFound, errWebhookRejected}, // redirects aren't followed
+	}
+
+	for _, tt := range tests {
+		var verified bool
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			timestamp, _ := strconv.ParseInt(r.Header.Get("X-Budget-Timestamp"), 10, 64)
+			verified = r.Header.Get("X-Budget-Signature") == signWebhook("endpoint-secret-0123", timestamp, body)
+			if tt.status == http.StatusFound {
+				w.Header().Set("Location", "https://169.254.169.254/")
+			}
+			w.WriteHeader(tt.status)
+		}))
+
+		// The test server's own transport, with the delivery client's
+		// redirect policy
+		client := server.Client()
+		client.CheckRedirect = newWebhookClient(time.Second).CheckRedirect
+
+		status, err := postWebhook(context.Background(), client, WebhookEndpoint{URL: server.URL, Secret: "endpoint-secret-0123"}, []byte(`{}`))
+		server.Close()
+
+		if status != tt.status || !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("status %d: postWebhook = %d, %v; want %v", tt.status, status, err, tt.want)
+		}
+		if !verified {
+			t.Errorf("status %d: signature didn't verify", tt.status)
+		}
+	}
+}
+
+func TestWebhookRetryDelayAfter(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{5, 16 * time.Minute},
+		{6, maxWebhookRetryDelay},
+		{40, maxWebhookRetryDelay},
+	}
+
+	for _, tt := range tests {
+		if got := webhookRetryDelayAfter(tt.failures); got != tt.want {
+			t.Errorf("webhookRetryDelayAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// Registers an endpoint for a fresh user and returns the user, the endpoint
+// and a counter of the requests it receives
+func webhookTestUser(t *testing.T, status int) (string, *int32, *httptest.Server) {
+	t.Helper()
+	t.Setenv("WEBHOOK_RETRY_BACKOFF", "1ms")
+
+	var hits int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	userID := "webhook-test-" + t.Name()
+	err := modifyWebhooks(userID, func(doc *userWebhooks) error {
+		doc.Endpoints = append(doc.Endpoints, WebhookEndpoint{ID: 1, URL: server.URL, Secret: "endpoint-secret-0123", MinLevel: alertLevelWarning})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID, &hits, server
+}
+
+// One delivery round at the given time, as notifyAlertWebhooks runs it
+func webhookRound(server *httptest.Server, userID string, alerts []Alert, now time.Time) int {
+	claims := claimWebhookDeliveries(userID, alerts, now)
+	if len(claims) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		recordWebhookDeliveries(userID, sendWebhookDeliveries(ctx, server.Client(), userID, claims))
+	}
+	return len(claims)
+}
+
+func TestWebhookDeliveredOnce(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   string
+	}{
+		{"accepted", http.StatusOK, "delivered"},
+		{"rejected", http.StatusUnprocessableEntity, "rejected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, hits, server := webhookTestUser(t, tt.status)
+			alerts := []Alert{{ID: "a1", Kind: alertBudgetThreshold, Level: alertLevelWarning}}
+			now := time.Now().UTC()
+
+			for i := 0; i < 3; i++ {
+				webhookRound(server, userID, alerts, now.Add(time.Duration(i)*time.Hour))
+			}
+
+			doc, _ := loadWebhooks(userID)
+			if *hits != 1 || len(doc.Deliveries) != 1 {
+				t.Fatalf("endpoint called %d times with %d deliveries logged, want 1", *hits, len(doc.Deliveries))
+			}
+			if doc.Deliveries[0].Status != tt.want || doc.Deliveries[0].Attempts != 1 {
+				t.Errorf("delivery = %+v, want %s after 1 attempt", doc.Deliveries[0], tt.want)
+			}
+			if _, sent := doc.Sent[webhookSentKey(1, "a1")]; !sent || len(doc.Claims) != 0 {
+				t.Errorf("sent %v with claims %v, want sent and no claims", sent, doc.Claims)
+			}
+		})
+	}
+}
+
+func TestWebhookFailedRoundsBackOff(t *testing.T) {
+	userID, hits, server := webhookTestUser(t, http.StatusServiceUnavailable)
+	alerts := []Alert{{ID: "a1", Kind: alertBudgetThreshold, Level: alertLevelWarning}}
+	now := time.Now().UTC()
+
+	if claimed := webhookRound(server, userID, alerts, now); claimed != 1 || *hits != maxWebhookAttempts {
+		t.Fatalf("first round claimed %d and called %d times, want 1 and %d", claimed, *hits, maxWebhookAttempts)
+	}
+
+	// A refresh during the retry delay doesn't try again
+	if claimed := webhookRound(server, userID, alerts, now.Add(30*time.Second)); claimed != 0 {
+		t.Errorf("claimed %d during the retry delay, want 0", claimed)
+	}
+
+	// Each later round waits longer, until the alert is given up on
+	at := now
+	for round := 2; round <= maxWebhookRetryRounds; round++ {
+		at = at.Add(webhookRetryDelayAfter(round-1) + time.Second)
+		if claimed := webhookRound(server, userID, alerts, at); claimed != 1 {
+			t.Fatalf("round %d claimed %d, want 1", round, claimed)
+		}
+	}
+	if claimed := webhookRound(server, userID, alerts, at.Add(24*time.Hour)); claimed != 0 {
+		t.Errorf("claimed %d after %d failed rounds, want 0", claimed, maxWebhookRetryRounds)
+	}
+
+	doc, _ := loadWebhooks(userID)
+	if len(doc.Deliveries) != maxWebhookRetryRounds || len(doc.Retries) != 0 {
+		t.Errorf("%d deliveries logged with retries %v, want %d and none", len(doc.Deliveries), doc.Retries, maxWebhookRetryRounds)
+	}
+	if doc.Deliveries[0].Status != "failed" {
+		t.Errorf("delivery status = %s, want failed", doc.Deliveries[0].Status)
+	}
+}
+
+func TestWebhookMinLevel(t *testing.T) {
+	userID, hits, server := webhookTestUser(t, http.StatusOK)
+	modifyWebhooks(userID, func(doc *userWebhooks) error {
+		doc.Endpoints[0].MinLevel = alertLevelCritical
+		return nil
+	})
+
+	alerts := []Alert{
+		{ID: "w", Kind: alertBudgetThreshold, Level: alertLevelWarning},
+		{ID: "c", Kind: alertBudgetThreshold, Level: alertLevelCritical},
+	}
+	if claimed := webhookRound(server, userID, alerts, time.Now().UTC()); claimed != 1 || *hits != 1 {
+		t.Errorf("claimed %d and called %d times, want only the critical alert", claimed, *hits)
+	}
+}
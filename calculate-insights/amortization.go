@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Limits on amortization requests
+const (
+	maxLoanTermMonths = 600 // 50 years
+	maxLoanRate       = 100
+	maxLoanAmount     = 1e9
+	maxPrepayments    = 120
+)
+
+// A one-off payment on top of the scheduled one
+type Prepayment struct {
+	Month  int     `json:"month"` // 1 is the first payment
+	Amount float64 `json:"amount"`
+}
+
+// Body of an amortization request
+type amortizationRequest struct {
+	Principal    float64      `json:"principal"`
+	AnnualRate   float64      `json:"annual_rate"` // %, e.g. 6.5
+	TermMonths   int          `json:"term_months"`
+	ExtraMonthly float64      `json:"extra_monthly"` // paid on top of every scheduled payment
+	Prepayments  []Prepayment `json:"prepayments"`
+}
+
+type AmortizationRow struct {
+	Month     int     `json:"month"`
+	Date      string  `json:"date"` // YYYY-MM
+	Payment   float64 `json:"payment"`
+	Principal float64 `json:"principal"`
+	Interest  float64 `json:"interest"`
+	Extra     float64 `json:"extra"` // extra monthly and prepayments, all towards principal
+	Balance   float64 `json:"balance"`
+}
+
+type AmortizationSummary struct {
+	Months        int     `json:"months"`
+	PayoffDate    string  `json:"payoff_date"` // YYYY-MM
+	TotalInterest float64 `json:"total_interest"`
+	TotalPaid     float64 `json:"total_paid"`
+}
+
+type Amortization struct {
+	MonthlyPayment float64             `json:"monthly_payment"` // scheduled payment, without extras
+	Summary        AmortizationSummary `json:"summary"`
+	Baseline       AmortizationSummary `json:"baseline"` // the loan without extra payments
+	InterestSaved  float64             `json:"interest_saved"`
+	MonthsSaved    int                 `json:"months_saved"`
+	Schedule       []AmortizationRow   `json:"schedule"`
+}
+
+// The fixed payment that repays principal over the term at the monthly rate
+func amortizedPayment(principal, monthlyRate float64, months int) float64 {
+	if monthlyRate == 0 {
+		return roundMoney(principal / float64(months))
+	}
+	return roundMoney(principal * monthlyRate / (1 - math.Pow(1+monthlyRate, -float64(months))))
+}
+
+// Runs the loan to payoff. Interest is charged on the balance each month and
+// rounded to cents; the final payment is whatever clears the balance.
+func amortize(request amortizationRequest, start time.Time) (float64, AmortizationSummary, []AmortizationRow) {
+	monthlyRate := request.AnnualRate / 100 / 12
+	payment := amortizedPayment(request.Principal, monthlyRate, request.TermMonths)
+
+	prepayments := make(map[int]float64, len(request.Prepayments))
+	for _, prepayment := range request.Prepayments {
+		prepayments[prepayment.Month] += prepayment.Amount
+	}
+
+	var summary AmortizationSummary
+	schedule := []AmortizationRow{}
+	balance := roundMoney(request.Principal)
+	for month := 1; balance > 0 && month <= maxLoanTermMonths+1; month++ {
+		row := AmortizationRow{Month: month, Date: start.AddDate(0, month-1, 0).Format("2006-01")}
+		row.Interest = roundMoney(balance * monthlyRate)
+
+		// The last payment clears the balance, including any cents left over
+		// from rounding the scheduled payment
+		row.Payment = payment
+		if due := roundMoney(balance + row.Interest); month >= request.TermMonths || due < payment {
+			row.Payment = due
+		}
+		row.Principal = roundMoney(row.Payment - row.Interest)
+
+		row.Extra = math.Min(roundMoney(request.ExtraMonthly+prepayments[month]), roundMoney(balance-row.Principal))
+		balance = roundMoney(balance - row.Principal - row.Extra)
+		row.Balance = balance
+
+		summary.Months = month
+		summary.PayoffDate = row.Date
+		summary.TotalInterest += row.Interest
+		summary.TotalPaid += row.Payment + row.Extra
+		schedule = append(schedule, row)
+	}
+	summary.TotalInterest = roundMoney(summary.TotalInterest)
+	summary.TotalPaid = roundMoney(summary.TotalPaid)
+	return payment, summary, schedule
+}
+
+func calculateAmortization(request amortizationRequest, start time.Time) Amortization {
+	payment, summary, schedule := amortize(request, start)
+	_, baseline, _ := amortize(amortizationRequest{Principal: request.Principal, AnnualRate: request.AnnualRate, TermMonths: request.TermMonths}, start)
+
+	return Amortization{
+		MonthlyPayment: payment,
+		Summary:        summary,
+		Baseline:       baseline,
+		InterestSaved:  roundMoney(baseline.TotalInterest - summary.TotalInterest),
+		MonthsSaved:    baseline.Months - summary.Months,
+		Schedule:       schedule,
+	}
+}
+
+func validateAmortizationRequest(request amortizationRequest) []FieldError {
+	var details []FieldError
+	if request.Principal <= 0 || request.Principal > maxLoanAmount {
+		details = append(details, FieldError{Field: "principal", Message: fmt.Sprintf("must be greater than 0 and at most %g", maxLoanAmount)})
+	}
+	if request.AnnualRate < 0 || request.AnnualRate > maxLoanRate {
+		details = append(details, FieldError{Field: "annual_rate", Message: fmt.Sprintf("must be between 0 and %d", maxLoanRate)})
+	}
+	if request.TermMonths < 1 || request.TermMonths > maxLoanTermMonths {
+		details = append(details, FieldError{Field: "term_months", Message: fmt.Sprintf("must be between 1 and %d", maxLoanTermMonths)})
+	}
+	if request.ExtraMonthly < 0 || request.ExtraMonthly > maxLoanAmount {
+		details = append(details, FieldError{Field: "extra_monthly", Message: fmt.Sprintf("must be between 0 and %g", maxLoanAmount)})
+	}
+
+	if len(request.Prepayments) > maxPrepayments {
+		details = append(details, FieldError{Field: "prepayments", Message: fmt.Sprintf("must contain at most %d prepayments", maxPrepayments)})
+		return details
+	}
+	for i, prepayment := range request.Prepayments {
+		field := fmt.Sprintf("prepayments[%d]", i)
+		if prepayment.Month < 1 || (request.TermMonths > 0 && prepayment.Month > request.TermMonths) {
+			details = append(details, FieldError{Field: field + ".month", Message: "must fall within the term"})
+		}
+		if prepayment.Amount <= 0 || prepayment.Amount > maxLoanAmount {
+			details = append(details, FieldError{Field: field + ".amount", Message: fmt.Sprintf("must be greater than 0 and at most %g", maxLoanAmount)})
+		}
+	}
+	return details
+}
+
+// Amortization schedule for a fixed-rate loan or mortgage:
+//
+//	POST ?action=amortization    {"principal": 250000, "annual_rate": 6.5, "term_months": 360, "extra_monthly": 100, "prepayments": [{"month": 12, "amount": 5000}]}
+//
+// Payments start next month. Extra payments go to principal, and the
+// baseline shows the same loan without them.
+func handleAmortization(w http.ResponseWriter, r *http.Request, requestID string) {
+	if _, err := verifyAuth(r.Header.Get("Authorization")); err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	var request amortizationRequest
+	hasBody, err := decodeJSONBody(w, r, &request)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	if !hasBody {
+		writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+		return
+	}
+	if details := validateAmortizationRequest(request); len(details) > 0 {
+		writeError(w, requestID, validationError(details))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"data":        calculateAmortization(request, firstPaymentMonth(time.Now())),
+		"computed_at": time.Now().Unix(),
+		"function":    "calculate-insights",
+		"runtime":     "Go",
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var amortizationStart = time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+
+func TestAmortizedPayment(t *testing.T) {
+	tests := []struct {
+		principal, annualRate float64
+		months                int
+		want                  float64
+	}{
+		{1000, 0, 3, 333.33},
+		{1200, 0, 12, 100},
+		{100000, 6, 360, 599.55},
+		{250000, 6.5, 360, 1580.17},
+		{1000, 12, 12, 88.85},
+	}
+
+	for _, tt := range tests {
+		if got := amortizedPayment(tt.principal, tt.annualRate/100/12, tt.months); got != tt.want {
+			t.Errorf("amortizedPayment(%v, %v%%, %d) = %v, want %v", tt.principal, tt.annualRate, tt.months, got, tt.want)
+		}
+	}
+}
+
+func TestAmortize(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       amortizationRequest
+		months        int
+		payoffDate    string
+		finalPayment  float64
+		totalInterest float64
+	}{
+		{
+			name:         "0% rate puts the rounding cents in the final payment",
+			request:      amortizationRequest{Principal: 1000, TermMonths: 3},
+			months:       3,
+			payoffDate:   "2027-01",
+			finalPayment: 333.34,
+		},
+		{
+			name:          "final payment clears the balance left by rounding",
+			request:       amortizationRequest{Principal: 1000, AnnualRate: 12, TermMonths: 12},
+			months:        12,
+			payoffDate:    "2027-10",
+			finalPayment:  88.84,
+			totalInterest: 66.19,
+		},
+		{
+			name:          "extra monthly shortens the loan",
+			request:       amortizationRequest{Principal: 1000, AnnualRate: 12, TermMonths: 12, ExtraMonthly: 100},
+			months:        6,
+			payoffDate:    "2027-04",
+			finalPayment:  88.57,
+			totalInterest: 32.82,
+		},
+		{
+			name:          "a prepayment larger than the balance only clears it",
+			request:       amortizationRequest{Principal: 1000, AnnualRate: 12, TermMonths: 12, Prepayments: []Prepayment{{Month: 2, Amount: 5000}}},
+			months:        2,
+			payoffDate:    "2026-12",
+			finalPayment:  88.85,
+			totalInterest: 19.21,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, summary, schedule := amortize(tt.request, amortizationStart)
+
+			if summary.Months != tt.months || summary.PayoffDate != tt.payoffDate || len(schedule) != tt.months {
+				t.Fatalf("months, payoff_date, rows = %d, %q, %d; want %d, %q, %d", summary.Months, summary.PayoffDate, len(schedule), tt.months, tt.payoffDate, tt.months)
+			}
+			last := schedule[len(schedule)-1]
+			if last.Payment != tt.finalPayment || last.Balance != 0 {
+				t.Errorf("final payment, balance = %v, %v; want %v, 0", last.Payment, last.Balance, tt.finalPayment)
+			}
+			if summary.TotalInterest != tt.totalInterest {
+				t.Errorf("total_interest = %v, want %v", summary.TotalInterest, tt.totalInterest)
+			}
+
+			// Every cent of principal is repaid, no more
+			repaid := 0.0
+			for _, row := range schedule {
+				repaid += row.Principal + row.Extra
+			}
+			if roundMoney(repaid) != tt.request.Principal {
+				t.Errorf("principal repaid = %v, want %v", roundMoney(repaid), tt.request.Principal)
+			}
+			if want := roundMoney(tt.request.Principal + tt.totalInterest); summary.TotalPaid != want {
+				t.Errorf("total_paid = %v, want %v", summary.TotalPaid, want)
+			}
+		})
+	}
+}
+
+func TestCalculateAmortizationSavings(t *testing.T) {
+	request := amortizationRequest{Principal: 1000, AnnualRate: 12, TermMonths: 12, ExtraMonthly: 100}
+	amortization := calculateAmortization(request, amortizationStart)
+
+	if amortization.MonthlyPayment != 88.85 {
+		t.Errorf("monthly_payment = %v, want 88.85", amortization.MonthlyPayment)
+	}
+	if amortization.Baseline.Months != 12 || amortization.MonthsSaved != 6 {
+		t.Errorf("baseline months, months saved = %d, %d; want 12, 6", amortization.Baseline.Months, amortization.MonthsSaved)
+	}
+	if amortization.InterestSaved != 33.37 {
+		t.Errorf("interest_saved = %v, want 33.37", amortization.InterestSaved)
+	}
+}
+
+func TestValidateAmortizationRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request amortizationRequest
+		fields  []string
+	}{
+		{"valid", amortizationRequest{Principal: 250000, AnnualRate: 6.5, TermMonths: 360}, nil},
+		{"0% rate", amortizationRequest{Principal: 1000, TermMonths: 3}, nil},
+		{"missing principal", amortizationRequest{TermMonths: 12}, []string{"principal"}},
+		{"negative rate", amortizationRequest{Principal: 1000, AnnualRate: -1, TermMonths: 12}, []string{"annual_rate"}},
+		{"term too long", amortizationRequest{Principal: 1000, TermMonths: maxLoanTermMonths + 1}, []string{"term_months"}},
+		{"negative extra", amortizationRequest{Principal: 1000, TermMonths: 12, ExtraMonthly: -5}, []string{"extra_monthly"}},
+		{"prepayment after the term", amortizationRequest{Principal: 1000, TermMonths: 12, Prepayments: []Prepayment{{Month: 13, Amount: 10}}}, []string{"prepayments[0].month"}},
+		{"empty prepayment", amortizationRequest{Principal: 1000, TermMonths: 12, Prepayments: []Prepayment{{Month: 1}}}, []string{"prepayments[0].amount"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, detail := range validateAmortizationRequest(tt.request) {
+				fields = append(fields, detail.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
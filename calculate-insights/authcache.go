@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The functions deploy separately and can't share code, so this file is kept
+// identical to budget-analyzer/authcache.go: change both together.
+
+// Upper bound on cached verifications before expired entries are swept
+const authCacheMaxEntries = 10000
+
+// authRejectedError marks a definitive "this token is not valid" answer from
+// auth-service, as opposed to a transport failure. Only rejections are
+// negatively cached.
+type authRejectedError struct {
+	reason string
+}
+
+func (e *authRejectedError) Error() string {
+	return "authentication failed: " + e.reason
+}
+
+type authCacheEntry struct {
+	userID    string
+	err       error
+	expiresAt time.Time
+}
+
+// authCache remembers verification results keyed by a SHA-256 of the
+// Authorization header, so raw tokens are never held in memory longer than
+// the request that carried them.
+type authCache struct {
+	mu      sync.Mutex
+	entries map[string]authCacheEntry
+}
+
+var verifiedTokens = &authCache{entries: make(map[string]authCacheEntry)}
+
+// Auth cache TTLs, overridable through the function environment
+func getAuthCacheTTL() time.Duration {
+	return envDuration("AUTH_CACHE_TTL", 60*time.Second)
+}
+
+func getAuthCacheNegativeTTL() time.Duration {
+	return envDuration("AUTH_CACHE_NEGATIVE_TTL", 10*time.Second)
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(name); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+func hashToken(authHeader string) string {
+	sum := sha256.Sum256([]byte(authHeader))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *authCache) get(key string) (authCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return authCacheEntry{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return authCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *authCache) put(key string, entry authCacheEntry) {
+	if !entry.expiresAt.After(time.Now()) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= authCacheMaxEntries {
+		c.sweepLocked()
+	}
+	if len(c.entries) >= authCacheMaxEntries {
+		return // Still full of live entries - skip caching rather than grow unbounded
+	}
+	c.entries[key] = entry
+}
+
+func (c *authCache) sweepLocked() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// tokenExpiry reads the `exp` claim from a bearer JWT without verifying it.
+// The signature is auth-service's concern; here the claim only shortens how
+// long a verified result may be reused.
+func tokenExpiry(authHeader string) (time.Time, bool) {
+	token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(*claims.Exp), 0), true
+}
+
+// Cache expiry for a successful verification: the configured TTL, but never
+// past the token's own expiry
+func verifiedExpiry(authHeader string, now time.Time) time.Time {
+	expiresAt := now.Add(getAuthCacheTTL())
+	if exp, ok := tokenExpiry(authHeader); ok && exp.Before(expiresAt) {
+		expiresAt = exp
+	}
+	return expiresAt
+}
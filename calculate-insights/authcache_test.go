@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A bearer JWT with the given claims; the signature is never checked here
+func testJWT(claims string) string {
+	return "Bearer header." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int64 // 0 for none
+	}{
+		{testJWT(`{"sub":"u1","exp":1760000000}`), 1760000000},
+		{testJWT(`{"sub":"u1","exp":1760000000.5}`), 1760000000},
+		{testJWT(`{"sub":"u1"}`), 0},
+		{testJWT(`not json`), 0},
+		{"Bearer opaque-token", 0},
+		{"Bearer a.!!!.c", 0},
+	}
+
+	for _, tt := range tests {
+		exp, ok := tokenExpiry(tt.header)
+		if ok != (tt.want != 0) || (ok && exp.Unix() != tt.want) {
+			t.Errorf("tokenExpiry(%q) = %v, %v; want %d", tt.header, exp, ok, tt.want)
+		}
+	}
+}
+
+func TestVerifiedExpiry(t *testing.T) {
+	t.Setenv("AUTH_CACHE_TTL", "60s")
+	now := time.Unix(1760000000, 0)
+
+	tests := []struct {
+		name   string
+		header string
+		want   time.Time
+	}{
+		{"opaque token gets the TTL", "Bearer opaque-token", now.Add(time.Minute)},
+		{"token expiring later gets the TTL", testJWT(`{"exp":1760000600}`), now.Add(time.Minute)},
+		{"token expiring sooner ends with it", testJWT(`{"exp":1760000010}`), now.Add(10 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		if got := verifiedExpiry(tt.header, now); !got.Equal(tt.want) {
+			t.Errorf("%s: verifiedExpiry = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// auth-service answering by token: bad-* tokens are rejected, down-* fail
+// and any other is valid
+func authTestServer(t *testing.T) *int32 {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		var response AuthServiceResponse
+		switch {
+		case strings.HasPrefix(token, "bad-"):
+			w.WriteHeader(http.StatusUnauthorized)
+			response.Error = "token expired"
+		case strings.HasPrefix(token, "down-"):
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			response.Success = true
+			response.User.ID = "user-" + token
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("AUTH_SERVICE_URL", server.URL)
+	return &calls
+}
+
+func TestVerifyAuthCaching(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		ttl   string
+		code  ErrorCode // "" for success
+		calls int32     // auth-service calls for two verifications
+	}{
+		{"valid token is cached", "ok-cached", "60s", "", 1},
+		{"rejection is cached", "bad-cached", "60s", CodeAuthInvalid, 1},
+		{"auth-service failure isn't cached", "down-cached", "60s", CodeAuthUnavailable, 2},
+		{"no TTL, no caching", "ok-uncached", "0s", "", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := authTestServer(t)
+			t.Setenv("AUTH_CACHE_TTL", tt.ttl)
+			header := "Bearer " + tt.token + "-" + fmt.Sprint(time.Now().UnixNano())
+
+			for i := 0; i < 2; i++ {
+				userID, err := verifyAuth(header)
+				var apiErr *APIError
+				switch {
+				case tt.code == "" && (err != nil || userID != "user-"+strings.TrimPrefix(header, "Bearer ")):
+					t.Fatalf("verification %d = %q, %v; want the user", i+1, userID, err)
+				case tt.code != "" && (!errors.As(err, &apiErr) || apiErr.Code != tt.code):
+					t.Fatalf("verification %d error = %v, want %s", i+1, err, tt.code)
+				}
+			}
+			if *calls != tt.calls {
+				t.Errorf("auth-service called %d times, want %d", *calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestVerifyAuthExpiredTokenNotCached(t *testing.T) {
+	calls := authTestServer(t)
+	header := testJWT(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(-time.Minute).Unix()))
+
+	for i := 0; i < 2; i++ {
+		if _, err := verifyAuth(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *calls != 2 {
+		t.Errorf("auth-service called %d times, want 2", *calls)
+	}
+}
+
+func TestAuthCacheBounded(t *testing.T) {
+	cache := &authCache{entries: make(map[string]authCacheEntry)}
+	live := time.Now().Add(time.Hour)
+
+	// Expired entries are swept to make room
+	for i := 0; i < authCacheMaxEntries; i++ {
+		cache.entries[fmt.Sprint("expired-", i)] = authCacheEntry{expiresAt: time.Now().Add(-time.Second)}
+	}
+	cache.put("fresh", authCacheEntry{userID: "u1", expiresAt: live})
+	if entry, ok := cache.get("fresh"); !ok || entry.userID != "u1" || len(cache.entries) != 1 {
+		t.Fatalf("after sweeping: get = %+v, %v with %d entries; want u1 alone", entry, ok, len(cache.entries))
+	}
+
+	// Live entries aren't evicted; the new one just isn't cached
+	for i := 0; i < authCacheMaxEntries; i++ {
+		cache.entries[fmt.Sprint("live-", i)] = authCacheEntry{expiresAt: live}
+	}
+	cache.put("overflow", authCacheEntry{userID: "u2", expiresAt: live})
+	if _, ok := cache.get("overflow"); ok {
+		t.Error("cached past the limit")
+	}
+}
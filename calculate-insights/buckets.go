@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Buckets that spending is classified into
+const (
+	bucketNeeds   = "needs"
+	bucketWants   = "wants"
+	bucketSavings = "savings" // savings and debt repayment
+)
+
+var validBuckets = map[string]bool{
+	bucketNeeds:   true,
+	bucketWants:   true,
+	bucketSavings: true,
+}
+
+// Same namespace as budget-analyzer, so a shared STORE_DIR shares overrides
+const bucketMappingNamespace = "bucket-mappings"
+
+// Where each known category falls; anything else counts as a want
+var defaultCategoryBuckets = map[string]string{
+	"housing":        bucketNeeds,
+	"rent":           bucketNeeds,
+	"utilities":      bucketNeeds,
+	"food":           bucketNeeds,
+	"groceries":      bucketNeeds,
+	"transportation": bucketNeeds,
+	"healthcare":     bucketNeeds,
+	"insurance":      bucketNeeds,
+	"education":      bucketNeeds,
+	"childcare":      bucketNeeds,
+	"entertainment":  bucketWants,
+	"shopping":       bucketWants,
+	"dining":         bucketWants,
+	"travel":         bucketWants,
+	"subscriptions":  bucketWants,
+	"other":          bucketWants,
+	"savings":        bucketSavings,
+	"investments":    bucketSavings,
+	"debt":           bucketSavings,
+	"loans":          bucketSavings,
+}
+
+// Share of income each bucket should take under the 50/30/20 guideline
+var bucketGuideline = map[string]float64{
+	bucketNeeds:   50,
+	bucketWants:   30,
+	bucketSavings: 20,
+}
+
+// Percentage points a bucket may stray from the guideline and still be on it
+const bucketTolerance = 2.0
+
+type BucketSummary struct {
+	Amount        float64  `json:"amount"`
+	ShareOfIncome float64  `json:"share_of_income"` // % of income
+	Guideline     float64  `json:"guideline"`       // % of income under 50/30/20
+	Difference    float64  `json:"difference"`      // share minus guideline, in percentage points
+	Status        string   `json:"status"`          // above_guideline, on_guideline, below_guideline, no_income
+	Categories    []string `json:"categories"`
+}
+
+type BucketBreakdown struct {
+	Needs         BucketSummary `json:"needs"`
+	Wants         BucketSummary `json:"wants"`
+	Savings       BucketSummary `json:"savings"`        // savings/debt categories plus unspent income
+	UnspentIncome float64       `json:"unspent_income"` // income left after all expenses
+	Guideline     string        `json:"guideline"`
+}
+
+// A user's category-to-bucket overrides, keyed by lower-cased category
+type bucketMappingRequest struct {
+	Mappings map[string]string `json:"mappings"`
+}
+
+func normalizeCategoryKey(category string) string {
+	return strings.ToLower(canonicalCategory(category))
+}
+
+// Bucket for a category: the nearest level of its hierarchy with a mapping,
+// preferring the user's overrides over the defaults at each level
+func bucketFor(category string, overrides map[string]string) string {
+	path := categoryPath(category)
+	for i := len(path) - 1; i >= 0; i-- {
+		key := normalizeCategoryKey(path[i])
+		if bucket, ok := overrides[key]; ok {
+			return bucket
+		}
+		if bucket, ok := defaultCategoryBuckets[key]; ok {
+			return bucket
+		}
+	}
+	return bucketWants
+}
+
+func loadBucketOverrides(userID string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	if _, err := documents.Load(bucketMappingNamespace, userID, &overrides); err != nil {
+		return nil, wrapAPIError(CodeInternal, "Bucket mapping storage is unavailable", err)
+	}
+	return overrides, nil
+}
+
+// Classifies spending into needs, wants and savings and compares each
+// bucket's share of income with the 50/30/20 guideline. Income that wasn't
+// spent counts as saved.
+func calculateBucketBreakdown(spending map[string]float64, income, expenses float64, overrides map[string]string) BucketBreakdown {
+	amounts := make(map[string]float64)
+	members := make(map[string][]string)
+	for category, amount := range spending {
+		bucket := bucketFor(category, overrides)
+		amounts[bucket] += amount
+		members[bucket] = append(members[bucket], category)
+	}
+
+	unspent := math.Max(income-expenses, 0)
+	amounts[bucketSavings] += unspent
+
+	summarize := func(bucket string) BucketSummary {
+		categories := members[bucket]
+		if categories == nil {
+			categories = []string{}
+		}
+		sort.Strings(categories)
+
+		summary := BucketSummary{
+			Amount:     roundMoney(amounts[bucket]),
+			Guideline:  bucketGuideline[bucket],
+			Status:     "no_income",
+			Categories: categories,
+		}
+		if income <= 0 {
+			return summary
+		}
+
+		share := amounts[bucket] / income * 100
+		summary.ShareOfIncome = roundMoney(share)
+		summary.Difference = roundMoney(share - summary.Guideline)
+		switch {
+		case summary.Difference > bucketTolerance:
+			summary.Status = "above_guideline"
+		case summary.Difference < -bucketTolerance:
+			summary.Status = "below_guideline"
+		default:
+			summary.Status = "on_guideline"
+		}
+		return summary
+	}
+
+	return BucketBreakdown{
+		Needs:         summarize(bucketNeeds),
+		Wants:         summarize(bucketWants),
+		Savings:       summarize(bucketSavings),
+		UnspentIncome: roundMoney(unspent),
+		Guideline:     "50/30/20",
+	}
+}
+
+func validateBucketMappings(mappings map[string]string) []FieldError {
+	var details []FieldError
+	if len(mappings) > maxBucketMappings {
+		details = append(details, FieldError{Field: "mappings", Message: fmt.Sprintf("must contain at most %d categories", maxBucketMappings)})
+	}
+
+	categories := make([]string, 0, len(mappings))
+	for category := range mappings {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	for _, category := range categories {
+		field := fmt.Sprintf("mappings[%s]", category)
+		switch key := normalizeCategoryKey(category); {
+		case key == "":
+			details = append(details, FieldError{Field: field, Message: "category is required"})
+		case len(key) > maxCategoryLength:
+			details = append(details, FieldError{Field: field, Message: fmt.Sprintf("category must be at most %d characters", maxCategoryLength)})
+		}
+		if !validBuckets[mappings[category]] {
+			details = append(details, FieldError{Field: field, Message: "must be one of needs, wants, savings"})
+		}
+	}
+	return details
+}
+
+// The authenticated user's category-to-bucket mapping:
+//
+//	GET    ?action=bucket-mapping    defaults merged with overrides
+//	PUT    ?action=bucket-mapping    replace overrides, {"mappings": {"dining": "wants"}}
+//	DELETE ?action=bucket-mapping    reset to defaults
+func handleBucketMapping(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, err := verifyAuth(r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var request bucketMappingRequest
+		hasBody, decodeErr := decodeJSONBody(w, r, &request)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+		if details := validateBucketMappings(request.Mappings); len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+
+		overrides := make(map[string]string, len(request.Mappings))
+		for category, bucket := range request.Mappings {
+			overrides[normalizeCategoryKey(category)] = bucket
+		}
+		if err := documents.Save(bucketMappingNamespace, userID, overrides); err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Bucket mapping storage is unavailable", err))
+			return
+		}
+		userInsights.invalidate(userID)
+	case "DELETE":
+		if err := documents.Delete(bucketMappingNamespace, userID); err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Bucket mapping storage is unavailable", err))
+			return
+		}
+		userInsights.invalidate(userID)
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	overrides, err := loadBucketOverrides(userID)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	effective := make(map[string]string, len(defaultCategoryBuckets)+len(overrides))
+	for category, bucket := range defaultCategoryBuckets {
+		effective[category] = bucket
+	}
+	for category, bucket := range overrides {
+		effective[category] = bucket
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"mappings":       effective,
+			"overrides":      overrides,
+			"default_bucket": bucketWants,
+		},
+		"computed_at": time.Now().Unix(),
+		"function":    "calculate-insights",
+		"runtime":     "Go",
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default number of users whose computed insights are kept in memory
+const defaultInsightCacheSize = 1000
+
+type cachedInsight struct {
+	etag       string
+	insight    Insight
+	computedAt time.Time
+}
+
+type insightCacheItem struct {
+	userID string
+	result cachedInsight
+}
+
+// insightCache is a bounded LRU of the most recent insight computed per user.
+// An entry is only reused while its ETag still matches the user's
+// transaction set, so a stale entry can never be served.
+type insightCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+var userInsights = newInsightCache(getInsightCacheSize())
+
+func getInsightCacheSize() int {
+	if value := os.Getenv("INSIGHT_CACHE_SIZE"); value != "" {
+		if size, err := strconv.Atoi(value); err == nil && size > 0 {
+			return size
+		}
+	}
+	return defaultInsightCacheSize
+}
+
+func newInsightCache(capacity int) *insightCache {
+	return &insightCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *insightCache) get(userID string) (cachedInsight, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[userID]
+	if !ok {
+		return cachedInsight{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*insightCacheItem).result, true
+}
+
+func (c *insightCache) put(userID string, result cachedInsight) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[userID]; ok {
+		elem.Value.(*insightCacheItem).result = result
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[userID] = c.order.PushFront(&insightCacheItem{userID: userID, result: result})
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*insightCacheItem).userID)
+	}
+}
+
+// invalidate drops a user's cached insight so the next request recomputes it
+func (c *insightCache) invalidate(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[userID]; ok {
+		c.order.Remove(elem)
+		delete(c.items, userID)
+	}
+}
+
+// insightETag fingerprints a transaction set, independently of the order
+// transaction-api returned it in, together with the user's bucket overrides,
+// savings goals and emergency fund options. Goal progress and recent
+// spending move with the calendar, so with either the date is part of it.
+func insightETag(transactions []Transaction, bucketOverrides map[string]string, goals []SavingsGoal, fundOpts emergencyFundOptions, now time.Time) string {
+	lines := make([]string, 0, len(transactions)+len(bucketOverrides)+len(goals)+2)
+	for category, bucket := range bucketOverrides {
+		lines = append(lines, "m|"+category+"|"+bucket)
+	}
+	for _, g := range goals {
+		lines = append(lines, fmt.Sprintf("g|%d|%s|%.2f|%s|%s|%.2f|%s|%s", g.ID, g.Name, g.TargetAmount, g.TargetDate, g.StartDate, g.InitialAmount, g.Tag, g.Category))
+	}
+	if len(goals) > 0 || len(transactions) > 0 {
+		lines = append(lines, "d|"+now.UTC().Format("2006-01-02"))
+	}
+	if fundOpts.Balance != nil {
+		lines = append(lines, fmt.Sprintf("e|%g|%.2f", fundOpts.TargetMonths, *fundOpts.Balance))
+	} else {
+		lines = append(lines, fmt.Sprintf("e|%g|", fundOpts.TargetMonths))
+	}
+	for _, t := range transactions {
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%.2f|%s|%s|%s",
+			t.ID, t.UpdatedAt.UTC().Format(time.RFC3339Nano), t.Date.UTC().Format(time.RFC3339Nano),
+			t.Amount, t.Type, t.Category, strings.Join(t.Tags, ",")))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Reports whether the request's If-None-Match header matches etag
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInsightCacheLRU(t *testing.T) {
+	cache := newInsightCache(2)
+	cache.put("a", cachedInsight{etag: "1"})
+	cache.put("b", cachedInsight{etag: "2"})
+	cache.get("a")
+	cache.put("c", cachedInsight{etag: "3"})
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("least recently used entry wasn't evicted")
+	}
+	if _, ok := cache.get("a"); !ok {
+		t.Error("recently used entry was evicted")
+	}
+
+	cache.invalidate("a")
+	if _, ok := cache.get("a"); ok {
+		t.Error("invalidated entry still cached")
+	}
+}
+
+func TestInsightETag(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	transactions := []Transaction{
+		{ID: "t1", Amount: 12.5, Category: "Dining", Type: "expense", Date: now.AddDate(0, 0, -1)},
+		{ID: "t2", Amount: 80, Category: "Groceries", Type: "expense", Date: now.AddDate(0, 0, -2)},
+	}
+	fundOpts := emergencyFundOptions{TargetMonths: 6}
+	base := insightETag(transactions, nil, nil, fundOpts, now)
+
+	if insightETag([]Transaction{transactions[1], transactions[0]}, nil, nil, fundOpts, now) != base {
+		t.Error("ETag depends on the order of transactions")
+	}
+
+	edited := append([]Transaction{}, transactions...)
+	edited[0].Category = "Groceries"
+	balance := 5000.0
+
+	for name, etag := range map[string]string{
+		"edited transaction": insightETag(edited, nil, nil, fundOpts, now),
+		"bucket override":    insightETag(transactions, map[string]string{"dining": "needs"}, nil, fundOpts, now),
+		"savings goal":       insightETag(transactions, nil, []SavingsGoal{{ID: 1, TargetAmount: 100}}, fundOpts, now),
+		"account balances":   insightETag(transactions, nil, nil, emergencyFundOptions{TargetMonths: 6, Balance: &balance}, now),
+		"target months":      insightETag(transactions, nil, nil, emergencyFundOptions{TargetMonths: 3}, now),
+		"next day":           insightETag(transactions, nil, nil, fundOpts, now.AddDate(0, 0, 1)),
+	} {
+		if etag == base {
+			t.Errorf("%s doesn't change the ETag", name)
+		}
+	}
+
+	// With nothing that moves with the calendar, the date doesn't matter
+	if insightETag(nil, nil, nil, fundOpts, now) != insightETag(nil, nil, nil, fundOpts, now.AddDate(0, 0, 1)) {
+		t.Error("empty insight changes daily")
+	}
+}
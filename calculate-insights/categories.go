@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Categories form a hierarchy. "Food > Groceries" is a child of "Food" by
+// its delimiter (CATEGORY_DELIMITER, default ">"), and CATEGORY_TREE can
+// place plain categories under a parent, e.g. {"groceries": "food"}.
+var categoryTree = loadCategoryTree()
+
+// Deepest hierarchy followed through CATEGORY_TREE, guarding against cycles
+const maxCategoryDepth = 10
+
+func getCategoryDelimiter() string {
+	if delimiter := strings.TrimSpace(os.Getenv("CATEGORY_DELIMITER")); delimiter != "" {
+		return delimiter
+	}
+	return ">"
+}
+
+// Child -> parent pairs from CATEGORY_TREE, keyed by lower-cased child
+func loadCategoryTree() map[string]string {
+	tree := make(map[string]string)
+	raw := os.Getenv("CATEGORY_TREE")
+	if raw == "" {
+		return tree
+	}
+
+	var configured map[string]string
+	if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+		log.Printf("calculate-insights: ignoring invalid CATEGORY_TREE: %v", err)
+		return tree
+	}
+	for child, parent := range configured {
+		if parent = strings.TrimSpace(parent); parent != "" {
+			tree[strings.ToLower(strings.TrimSpace(child))] = parent
+		}
+	}
+	return tree
+}
+
+// Category with consistent spacing around delimiters, so "Food>Groceries"
+// and "Food > Groceries" are the same category
+func canonicalCategory(category string) string {
+	delimiter := getCategoryDelimiter()
+
+	var segments []string
+	for _, segment := range strings.Split(category, delimiter) {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, " "+delimiter+" ")
+}
+
+// The category and its ancestors, root first: "Food > Groceries" gives
+// ["Food", "Food > Groceries"]
+func categoryPath(category string) []string {
+	delimiter := getCategoryDelimiter()
+	canonical := canonicalCategory(category)
+	if canonical == "" {
+		return nil
+	}
+
+	segments := strings.Split(canonical, " "+delimiter+" ")
+	path := make([]string, len(segments))
+	for i := range segments {
+		path[i] = strings.Join(segments[:i+1], " "+delimiter+" ")
+	}
+
+	// Configured parents of the top-level category
+	seen := map[string]bool{strings.ToLower(path[0]): true}
+	for len(path) < maxCategoryDepth {
+		parent, ok := categoryTree[strings.ToLower(path[0])]
+		if !ok || seen[strings.ToLower(parent)] {
+			break
+		}
+		seen[strings.ToLower(parent)] = true
+		path = append([]string{canonicalCategory(parent)}, path...)
+	}
+
+	return path
+}
+
+// Reports whether the category with this path is ancestor (canonical) or
+// one of its descendants
+func categoryWithin(path []string, ancestor string) bool {
+	for _, node := range path {
+		if strings.EqualFold(node, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// CategoryNode is one level of the category hierarchy with the spending of
+// the category and all of its subcategories
+type CategoryNode struct {
+	Category string         `json:"category"` // as transactions name it, e.g. "Food > Groceries", or "Groceries" when CATEGORY_TREE places it under Food
+	Amount   float64        `json:"amount"`
+	Children []CategoryNode `json:"children,omitempty"`
+}
+
+// Rolls flat per-category spending up through every level of the hierarchy,
+// largest first at each level
+func buildCategoryTree(spending map[string]float64) []CategoryNode {
+	type treeNode struct {
+		name     string
+		amount   float64
+		children map[string]*treeNode
+	}
+	root := &treeNode{children: make(map[string]*treeNode)}
+
+	for category, amount := range spending {
+		node := root
+		for _, level := range categoryPath(category) {
+			key := strings.ToLower(level)
+			child, ok := node.children[key]
+			if !ok {
+				child = &treeNode{name: level, children: make(map[string]*treeNode)}
+				node.children[key] = child
+			} else if level < child.name {
+				child.name = level // the same spelling whatever order the map is walked in
+			}
+			child.amount += amount
+			node = child
+		}
+	}
+
+	var convert func(children map[string]*treeNode) []CategoryNode
+	convert = func(children map[string]*treeNode) []CategoryNode {
+		var nodes []CategoryNode
+		for _, child := range children {
+			nodes = append(nodes, CategoryNode{
+				Category: child.name,
+				Amount:   roundMoney(child.amount),
+				Children: convert(child.children),
+			})
+		}
+		sort.Slice(nodes, func(i, j int) bool {
+			if nodes[i].Amount != nodes[j].Amount {
+				return nodes[i].Amount > nodes[j].Amount
+			}
+			return nodes[i].Category < nodes[j].Category
+		})
+		return nodes
+	}
+
+	nodes := convert(root.children)
+	if nodes == nil {
+		nodes = []CategoryNode{}
+	}
+	return nodes
+}
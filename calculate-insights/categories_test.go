@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildCategoryTree(t *testing.T) {
+	saved := categoryTree
+	categoryTree = map[string]string{"groceries": "Food"}
+	t.Cleanup(func() { categoryTree = saved })
+
+	spending := map[string]float64{
+		"Food > Dining":          120.5,
+		"food>dining":            10,
+		"Groceries":              200,
+		"Food":                   15,
+		"Rent":                   1500,
+		"Food > Dining > Coffee": 4.25,
+	}
+
+	want := []CategoryNode{
+		{Category: "Rent", Amount: 1500},
+		{Category: "Food", Amount: 349.75, Children: []CategoryNode{
+			{Category: "Groceries", Amount: 200},
+			{Category: "Food > Dining", Amount: 134.75, Children: []CategoryNode{
+				{Category: "Food > Dining > Coffee", Amount: 4.25},
+			}},
+		}},
+	}
+	if got := buildCategoryTree(spending); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildCategoryTree = %+v\nwant %+v", got, want)
+	}
+}
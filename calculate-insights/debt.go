@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits on debt plans
+const (
+	maxDebts          = 20
+	maxDebtPlanMonths = 600 // 50 years
+	maxDebtAPR        = 100
+	maxDebtNameLength = 100
+	maxDebtAmount     = 1e9
+)
+
+var debtStrategies = []string{"avalanche", "snowball", "custom"}
+
+type Debt struct {
+	Name           string  `json:"name"`
+	Balance        float64 `json:"balance"`
+	APR            float64 `json:"apr"` // annual percentage rate, e.g. 19.99
+	MinimumPayment float64 `json:"minimum_payment"`
+}
+
+// Body of a debt plan request. Strategy picks one of avalanche (highest APR
+// first), snowball (smallest balance first) or custom (Order, by name);
+// without it every strategy that applies is planned.
+type debtPlanRequest struct {
+	Debts          []Debt   `json:"debts"`
+	MonthlyPayment float64  `json:"monthly_payment"` // total paid towards all debts each month
+	Strategy       string   `json:"strategy"`
+	Order          []string `json:"order"`
+}
+
+type DebtPayment struct {
+	Name     string  `json:"name"`
+	Payment  float64 `json:"payment"`
+	Interest float64 `json:"interest"`
+	Balance  float64 `json:"balance"` // after the payment
+}
+
+type DebtPlanMonth struct {
+	Month            int           `json:"month"` // 1 is the first payment
+	Date             string        `json:"date"`  // YYYY-MM
+	Payments         []DebtPayment `json:"payments"`
+	TotalPaid        float64       `json:"total_paid"`
+	TotalInterest    float64       `json:"total_interest"`
+	RemainingBalance float64       `json:"remaining_balance"`
+}
+
+type DebtPayoff struct {
+	Name         string  `json:"name"`
+	PayoffMonth  int     `json:"payoff_month"`          // 0 when not paid off within the plan
+	PayoffDate   string  `json:"payoff_date,omitempty"` // YYYY-MM
+	InterestPaid float64 `json:"interest_paid"`
+	TotalPaid    float64 `json:"total_paid"`
+}
+
+// A plan still owing money after maxDebtPlanMonths is cut off there: PaidOff
+// is false, Months is the cap and RemainingBalance what is left
+type DebtPlan struct {
+	Strategy         string          `json:"strategy"`
+	Order            []string        `json:"order"` // priority for payments above the minimums
+	PaidOff          bool            `json:"paid_off"`
+	Months           int             `json:"months"`
+	PayoffDate       string          `json:"payoff_date,omitempty"` // YYYY-MM; empty when not paid off
+	RemainingBalance float64         `json:"remaining_balance"`
+	TotalInterest    float64         `json:"total_interest"`
+	TotalPaid        float64         `json:"total_paid"`
+	Debts            []DebtPayoff    `json:"debts"`
+	Schedule         []DebtPlanMonth `json:"schedule"`
+}
+
+// Debt indexes in payment priority for a strategy
+func debtPriority(debts []Debt, strategy string, order []string) []int {
+	priority := make([]int, len(debts))
+	for i := range priority {
+		priority[i] = i
+	}
+
+	switch strategy {
+	case "avalanche":
+		sort.SliceStable(priority, func(a, b int) bool {
+			da, db := debts[priority[a]], debts[priority[b]]
+			if da.APR != db.APR {
+				return da.APR > db.APR
+			}
+			return da.Balance < db.Balance
+		})
+	case "snowball":
+		sort.SliceStable(priority, func(a, b int) bool {
+			da, db := debts[priority[a]], debts[priority[b]]
+			if da.Balance != db.Balance {
+				return da.Balance < db.Balance
+			}
+			return da.APR > db.APR
+		})
+	case "custom":
+		// Listed debts first, in the given order, then the rest as submitted
+		rank := make(map[string]int, len(order))
+		for i, name := range order {
+			rank[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		position := func(i int) int {
+			if r, ok := rank[strings.ToLower(strings.TrimSpace(debts[i].Name))]; ok {
+				return r
+			}
+			return len(order) + i
+		}
+		sort.SliceStable(priority, func(a, b int) bool { return position(priority[a]) < position(priority[b]) })
+	}
+	return priority
+}
+
+// Simulates paying the debts month by month: interest accrues, every debt
+// gets its minimum, and whatever is left of the monthly payment goes to the
+// first unpaid debt in priority order. Minimums freed by paid-off debts roll
+// into the extra payment.
+func simulateDebtPlan(debts []Debt, monthlyPayment float64, strategy string, order []string, start time.Time) DebtPlan {
+	priority := debtPriority(debts, strategy, order)
+	plan := DebtPlan{Strategy: strategy, Order: make([]string, 0, len(debts)), Schedule: []DebtPlanMonth{}}
+	for _, i := range priority {
+		plan.Order = append(plan.Order, debts[i].Name)
+	}
+
+	balances := make([]float64, len(debts))
+	payoffs := make([]DebtPayoff, len(debts))
+	for i, debt := range debts {
+		balances[i] = roundMoney(debt.Balance)
+		payoffs[i].Name = debt.Name
+	}
+
+	outstanding := func() float64 {
+		total := 0.0
+		for _, balance := range balances {
+			total += balance
+		}
+		return total
+	}
+
+	for month := 1; outstanding() > 0 && month <= maxDebtPlanMonths; month++ {
+		date := start.AddDate(0, month-1, 0).Format("2006-01")
+		payments := make([]DebtPayment, len(debts))
+		available := monthlyPayment
+
+		for i, debt := range debts {
+			payments[i].Name = debt.Name
+			if balances[i] <= 0 {
+				continue
+			}
+			interest := roundMoney(balances[i] * debt.APR / 100 / 12)
+			balances[i] = roundMoney(balances[i] + interest)
+			payments[i].Interest = interest
+
+			minimum := math.Min(debt.MinimumPayment, balances[i])
+			payments[i].Payment = minimum
+			available -= minimum
+		}
+
+		for _, i := range priority {
+			if available <= 0 {
+				break
+			}
+			extra := math.Min(available, balances[i]-payments[i].Payment)
+			if extra > 0 {
+				payments[i].Payment = roundMoney(payments[i].Payment + extra)
+				available = roundMoney(available - extra)
+			}
+		}
+
+		row := DebtPlanMonth{Month: month, Date: date, Payments: payments}
+		for i := range debts {
+			if payments[i].Payment == 0 && payments[i].Interest == 0 {
+				continue
+			}
+			balances[i] = roundMoney(balances[i] - payments[i].Payment)
+			payments[i].Balance = balances[i]
+			payoffs[i].InterestPaid += payments[i].Interest
+			payoffs[i].TotalPaid += payments[i].Payment
+			if balances[i] <= 0 && payoffs[i].PayoffMonth == 0 {
+				payoffs[i].PayoffMonth = month
+				payoffs[i].PayoffDate = date
+			}
+			row.TotalPaid += payments[i].Payment
+			row.TotalInterest += payments[i].Interest
+		}
+		row.TotalPaid = roundMoney(row.TotalPaid)
+		row.TotalInterest = roundMoney(row.TotalInterest)
+		row.RemainingBalance = roundMoney(outstanding())
+
+		plan.Schedule = append(plan.Schedule, row)
+		plan.Months = month
+		plan.TotalInterest += row.TotalInterest
+		plan.TotalPaid += row.TotalPaid
+	}
+
+	plan.RemainingBalance = roundMoney(outstanding())
+	plan.PaidOff = plan.RemainingBalance <= 0
+	if plan.PaidOff && plan.Months > 0 {
+		plan.PayoffDate = plan.Schedule[plan.Months-1].Date
+	}
+
+	plan.TotalInterest = roundMoney(plan.TotalInterest)
+	plan.TotalPaid = roundMoney(plan.TotalPaid)
+	for _, i := range priority {
+		payoffs[i].InterestPaid = roundMoney(payoffs[i].InterestPaid)
+		payoffs[i].TotalPaid = roundMoney(payoffs[i].TotalPaid)
+		plan.Debts = append(plan.Debts, payoffs[i])
+	}
+	return plan
+}
+
+func validateDebtPlanRequest(request debtPlanRequest) []FieldError {
+	var details []FieldError
+	if len(request.Debts) == 0 || len(request.Debts) > maxDebts {
+		details = append(details, FieldError{Field: "debts", Message: fmt.Sprintf("must contain between 1 and %d debts", maxDebts)})
+	}
+
+	names := make(map[string]bool, len(request.Debts))
+	minimums, interest := 0.0, 0.0
+	for i, debt := range request.Debts {
+		field := fmt.Sprintf("debts[%d]", i)
+		switch name := strings.ToLower(strings.TrimSpace(debt.Name)); {
+		case name == "":
+			details = append(details, FieldError{Field: field + ".name", Message: "is required"})
+		case len(name) > maxDebtNameLength:
+			details = append(details, FieldError{Field: field + ".name", Message: fmt.Sprintf("must be at most %d characters", maxDebtNameLength)})
+		case names[name]:
+			details = append(details, FieldError{Field: field + ".name", Message: "must be unique"})
+		default:
+			names[name] = true
+		}
+		if debt.Balance <= 0 || debt.Balance > maxDebtAmount {
+			details = append(details, FieldError{Field: field + ".balance", Message: fmt.Sprintf("must be greater than 0 and at most %g", maxDebtAmount)})
+		}
+		if debt.APR < 0 || debt.APR > maxDebtAPR {
+			details = append(details, FieldError{Field: field + ".apr", Message: fmt.Sprintf("must be between 0 and %d", maxDebtAPR)})
+		}
+		if debt.MinimumPayment < 0 || debt.MinimumPayment > maxDebtAmount {
+			details = append(details, FieldError{Field: field + ".minimum_payment", Message: fmt.Sprintf("must be between 0 and %g", maxDebtAmount)})
+		} else if debt.MinimumPayment == 0 && debt.APR > 0 {
+			details = append(details, FieldError{Field: field + ".minimum_payment", Message: "must be greater than 0 for a debt that accrues interest"})
+		}
+		minimums += debt.MinimumPayment
+		interest += debt.Balance * debt.APR / 100 / 12
+	}
+
+	switch {
+	case request.MonthlyPayment <= 0 || request.MonthlyPayment > maxDebtAmount:
+		details = append(details, FieldError{Field: "monthly_payment", Message: fmt.Sprintf("must be greater than 0 and at most %g", maxDebtAmount)})
+	case request.MonthlyPayment < minimums:
+		details = append(details, FieldError{Field: "monthly_payment", Message: fmt.Sprintf("must cover the minimum payments (%.2f)", roundMoney(minimums))})
+	case request.MonthlyPayment <= interest:
+		details = append(details, FieldError{Field: "monthly_payment", Message: fmt.Sprintf("must exceed the monthly interest (%.2f) for the debts to shrink", roundMoney(interest))})
+	}
+
+	switch request.Strategy {
+	case "", "avalanche", "snowball":
+	case "custom":
+		if len(request.Order) == 0 {
+			details = append(details, FieldError{Field: "order", Message: "is required for the custom strategy"})
+		}
+	default:
+		details = append(details, FieldError{Field: "strategy", Message: "must be one of avalanche, snowball, custom"})
+	}
+	for i, name := range request.Order {
+		if !names[strings.ToLower(strings.TrimSpace(name))] {
+			details = append(details, FieldError{Field: fmt.Sprintf("order[%d]", i), Message: "must name one of the debts"})
+		}
+	}
+	return details
+}
+
+// Plans paying off debts under each strategy:
+//
+//	POST ?action=debt-plan    {"debts": [{"name": "Visa", "balance": 4200, "apr": 22.9, "minimum_payment": 120}], "monthly_payment": 600}
+//
+// Payments start next month. The recommended plan pays the debts off, if any
+// plan does, with the least interest.
+func handleDebtPlan(w http.ResponseWriter, r *http.Request, requestID string) {
+	if _, err := verifyAuth(r.Header.Get("Authorization")); err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	var request debtPlanRequest
+	hasBody, err := decodeJSONBody(w, r, &request)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	if !hasBody {
+		writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+		return
+	}
+	if details := validateDebtPlanRequest(request); len(details) > 0 {
+		writeError(w, requestID, validationError(details))
+		return
+	}
+
+	strategies := []string{request.Strategy}
+	if request.Strategy == "" {
+		strategies = nil
+		for _, strategy := range debtStrategies {
+			if strategy != "custom" || len(request.Order) > 0 {
+				strategies = append(strategies, strategy)
+			}
+		}
+	}
+
+	start := firstPaymentMonth(time.Now())
+
+	plans := make([]DebtPlan, 0, len(strategies))
+	recommended := 0
+	for _, strategy := range strategies {
+		plan := simulateDebtPlan(request.Debts, request.MonthlyPayment, strategy, request.Order, start)
+		plans = append(plans, plan)
+		if betterDebtPlan(plan, plans[recommended]) {
+			recommended = len(plans) - 1
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"plans":       plans,
+			"recommended": plans[recommended].Strategy,
+			// Interest saved by the recommended plan over the costliest
+			// comparable one
+			"interest_saved": roundMoney(maxPlanInterest(plans, plans[recommended].PaidOff) - plans[recommended].TotalInterest),
+		},
+		"computed_at": time.Now().Unix(),
+		"function":    "calculate-insights",
+		"runtime":     "Go",
+	})
+}
+
+// Reports whether plan a beats plan b: paying the debts off comes first, then
+// less interest, then sooner. Of plans cut off at the cap, the one leaving
+// less owed wins, since its lower interest only reflects a larger balance.
+func betterDebtPlan(a, b DebtPlan) bool {
+	switch {
+	case a.PaidOff != b.PaidOff:
+		return a.PaidOff
+	case !a.PaidOff && a.RemainingBalance != b.RemainingBalance:
+		return a.RemainingBalance < b.RemainingBalance
+	case a.TotalInterest != b.TotalInterest:
+		return a.TotalInterest < b.TotalInterest
+	}
+	return a.Months < b.Months
+}
+
+// Highest interest among the plans that did, or did not, pay the debts off
+func maxPlanInterest(plans []DebtPlan, paidOff bool) float64 {
+	highest := 0.0
+	for _, plan := range plans {
+		if plan.PaidOff == paidOff {
+			highest = math.Max(highest, plan.TotalInterest)
+		}
+	}
+	return highest
+}
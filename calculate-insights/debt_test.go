@@ -0,0 +1,183 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var debtPlanStart = time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+
+func TestDebtPriority(t *testing.T) {
+	debts := []Debt{
+		{Name: "Car", Balance: 9000, APR: 6},
+		{Name: "Visa", Balance: 4200, APR: 22.9},
+		{Name: "Store", Balance: 600, APR: 22.9},
+	}
+
+	tests := []struct {
+		strategy string
+		order    []string
+		want     []int
+	}{
+		{"avalanche", nil, []int{2, 1, 0}}, // equal APRs: smaller balance first
+		{"snowball", nil, []int{2, 1, 0}},
+		{"custom", []string{" car "}, []int{0, 1, 2}},
+		{"custom", []string{"VISA", "Car"}, []int{1, 0, 2}},
+	}
+
+	for _, tt := range tests {
+		if got := debtPriority(debts, tt.strategy, tt.order); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("debtPriority(%s, %v) = %v, want %v", tt.strategy, tt.order, got, tt.want)
+		}
+	}
+}
+
+func TestSimulateDebtPlan(t *testing.T) {
+	tests := []struct {
+		name          string
+		debts         []Debt
+		payment       float64
+		strategy      string
+		paidOff       bool
+		months        int
+		payoffDate    string
+		remaining     float64
+		totalInterest float64
+		totalPaid     float64
+	}{
+		{
+			name:       "zero APR pays down the balance evenly",
+			debts:      []Debt{{Name: "Loan", Balance: 1000, MinimumPayment: 0}},
+			payment:    300,
+			strategy:   "avalanche",
+			paidOff:    true,
+			months:     4,
+			payoffDate: "2027-02",
+			totalPaid:  1000,
+		},
+		{
+			name:          "interest accrues before the payment",
+			debts:         []Debt{{Name: "Visa", Balance: 1000, APR: 12, MinimumPayment: 50}},
+			payment:       1010,
+			strategy:      "avalanche",
+			paidOff:       true,
+			months:        1,
+			payoffDate:    "2026-11",
+			totalInterest: 10,
+			totalPaid:     1010,
+		},
+		{
+			name:          "freed minimums roll into the next debt",
+			debts:         []Debt{{Name: "Store", Balance: 100, MinimumPayment: 50}, {Name: "Card", Balance: 300, MinimumPayment: 50}},
+			payment:       150,
+			strategy:      "snowball",
+			paidOff:       true,
+			months:        3,
+			payoffDate:    "2027-01",
+			totalInterest: 0,
+			totalPaid:     400,
+		},
+		{
+			name:          "a debt still owed at the cap is not paid off",
+			debts:         []Debt{{Name: "Mortgage", Balance: 100000, APR: 12, MinimumPayment: 1001}},
+			payment:       1001,
+			strategy:      "avalanche",
+			paidOff:       false,
+			months:        maxDebtPlanMonths,
+			payoffDate:    "",
+			remaining:     60948.7,
+			totalInterest: 561548.7,
+			totalPaid:     600600,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := simulateDebtPlan(tt.debts, tt.payment, tt.strategy, nil, debtPlanStart)
+
+			if plan.PaidOff != tt.paidOff || plan.Months != tt.months || plan.PayoffDate != tt.payoffDate {
+				t.Errorf("paid_off, months, payoff_date = %v, %d, %q; want %v, %d, %q", plan.PaidOff, plan.Months, plan.PayoffDate, tt.paidOff, tt.months, tt.payoffDate)
+			}
+			if plan.RemainingBalance != tt.remaining {
+				t.Errorf("remaining_balance = %v, want %v", plan.RemainingBalance, tt.remaining)
+			}
+			if plan.TotalInterest != tt.totalInterest || plan.TotalPaid != tt.totalPaid {
+				t.Errorf("total_interest, total_paid = %v, %v; want %v, %v", plan.TotalInterest, plan.TotalPaid, tt.totalInterest, tt.totalPaid)
+			}
+			if len(plan.Schedule) != tt.months {
+				t.Errorf("schedule has %d months, want %d", len(plan.Schedule), tt.months)
+			}
+			if last := plan.Schedule[len(plan.Schedule)-1]; last.RemainingBalance != tt.remaining {
+				t.Errorf("last month leaves %v, want %v", last.RemainingBalance, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestSimulateDebtPlanPayoffs(t *testing.T) {
+	debts := []Debt{{Name: "Card", Balance: 300, MinimumPayment: 50}, {Name: "Store", Balance: 100, MinimumPayment: 50}}
+	plan := simulateDebtPlan(debts, 150, "snowball", nil, debtPlanStart)
+
+	want := []DebtPayoff{
+		{Name: "Store", PayoffMonth: 1, PayoffDate: "2026-11", TotalPaid: 100},
+		{Name: "Card", PayoffMonth: 3, PayoffDate: "2027-01", TotalPaid: 300},
+	}
+	if !reflect.DeepEqual(plan.Debts, want) {
+		t.Errorf("debts = %+v, want %+v", plan.Debts, want)
+	}
+}
+
+func TestBetterDebtPlan(t *testing.T) {
+	paid := DebtPlan{PaidOff: true, Months: 40, TotalInterest: 900}
+	tests := []struct {
+		name string
+		a, b DebtPlan
+		want bool
+	}{
+		{"paying off beats lower interest", paid, DebtPlan{Months: 600, RemainingBalance: 10, TotalInterest: 100}, true},
+		{"less interest", DebtPlan{PaidOff: true, Months: 45, TotalInterest: 800}, paid, true},
+		{"same interest, sooner", DebtPlan{PaidOff: true, Months: 39, TotalInterest: 900}, paid, true},
+		{"equal plans", paid, paid, false},
+		{"cut off plans compare what is left", DebtPlan{Months: 600, RemainingBalance: 10, TotalInterest: 900}, DebtPlan{Months: 600, RemainingBalance: 20, TotalInterest: 100}, true},
+	}
+
+	for _, tt := range tests {
+		if got := betterDebtPlan(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: betterDebtPlan = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateDebtPlanRequest(t *testing.T) {
+	visa := Debt{Name: "Visa", Balance: 4200, APR: 22.9, MinimumPayment: 120}
+
+	tests := []struct {
+		name    string
+		request debtPlanRequest
+		fields  []string
+	}{
+		{"valid", debtPlanRequest{Debts: []Debt{visa}, MonthlyPayment: 600}, nil},
+		{"no minimum at 0% APR", debtPlanRequest{Debts: []Debt{{Name: "Loan", Balance: 1000}}, MonthlyPayment: 100}, nil},
+		{"no debts", debtPlanRequest{MonthlyPayment: 100}, []string{"debts"}},
+		{"no minimum on an interest-bearing debt", debtPlanRequest{Debts: []Debt{{Name: "Visa", Balance: 4200, APR: 22.9}}, MonthlyPayment: 600}, []string{"debts[0].minimum_payment"}},
+		{"duplicate names", debtPlanRequest{Debts: []Debt{visa, {Name: " visa ", Balance: 10, MinimumPayment: 5}}, MonthlyPayment: 600}, []string{"debts[1].name"}},
+		{"payment below the minimums", debtPlanRequest{Debts: []Debt{visa}, MonthlyPayment: 100}, []string{"monthly_payment"}},
+		{"payment at the interest", debtPlanRequest{Debts: []Debt{{Name: "Visa", Balance: 12000, APR: 12, MinimumPayment: 100}}, MonthlyPayment: 120}, []string{"monthly_payment"}},
+		{"custom without an order", debtPlanRequest{Debts: []Debt{visa}, MonthlyPayment: 600, Strategy: "custom"}, []string{"order"}},
+		{"unknown strategy", debtPlanRequest{Debts: []Debt{visa}, MonthlyPayment: 600, Strategy: "fastest"}, []string{"strategy"}},
+		{"order names an unknown debt", debtPlanRequest{Debts: []Debt{visa}, MonthlyPayment: 600, Order: []string{"Amex"}}, []string{"order[0]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, detail := range validateDebtPlanRequest(tt.request) {
+				fields = append(fields, detail.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Emergency fund coverage compares what a user has set aside with what they
+// spend on essentials (the needs bucket), i.e. how long they could get by
+// without income
+const (
+	defaultEmergencyTargetMonths = 6
+	maxEmergencyTargetMonths     = 60
+	maxAccountBalances           = 20
+	maxAccountBalance            = 1e12
+	maxAccountNameLength         = 100
+	emergencySpendWindowDays     = 90 // recent spending that sets the monthly averages
+)
+
+const accountBalancesNamespace = "account-balances"
+
+// Emergency fund statuses
+const (
+	emergencyFunded     = "funded"      // at least the target
+	emergencyBuilding   = "building"    // at least half the target
+	emergencyLow        = "low"         // at least a month
+	emergencyCritical   = "critical"    // under a month
+	emergencyNoSpending = "no_spending" // nothing recent to cover
+)
+
+// What the coverage is measured against: the stored account balances and
+// the request's target
+type emergencyFundOptions struct {
+	Balance      *float64 // sum of the user's account balances; nil falls back to net savings
+	TargetMonths float64
+}
+
+// AccountBalance is what one of the user's accounts holds, as they last
+// reported it. Balances are stored rather than passed with each insights
+// request so they stay out of URLs and the logs that record them.
+type AccountBalance struct {
+	Name    string  `json:"name"`
+	Balance float64 `json:"balance"`
+}
+
+// Stored form of one user's account balances
+type userAccountBalances struct {
+	Accounts  []AccountBalance `json:"accounts"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+func loadAccountBalances(userID string) (userAccountBalances, error) {
+	doc := userAccountBalances{Accounts: []AccountBalance{}}
+	if _, err := documents.Load(accountBalancesNamespace, userID, &doc); err != nil {
+		return doc, wrapAPIError(CodeInternal, "Account balance storage is unavailable", err)
+	}
+	return doc, nil
+}
+
+// Sum of the user's stored balances, nil when none are stored
+func (doc userAccountBalances) total() *float64 {
+	if len(doc.Accounts) == 0 {
+		return nil
+	}
+	total := 0.0
+	for _, account := range doc.Accounts {
+		total += account.Balance
+	}
+	return &total
+}
+
+func validateAccountBalances(accounts []AccountBalance) []FieldError {
+	var details []FieldError
+	if len(accounts) > maxAccountBalances {
+		return append(details, FieldError{Field: "accounts", Message: fmt.Sprintf("must contain at most %d accounts", maxAccountBalances)})
+	}
+
+	seen := make(map[string]bool, len(accounts))
+	for i, account := range accounts {
+		name := strings.TrimSpace(account.Name)
+		switch {
+		case name == "":
+			details = append(details, FieldError{Field: fmt.Sprintf("accounts[%d].name", i), Message: "is required"})
+		case len(name) > maxAccountNameLength:
+			details = append(details, FieldError{Field: fmt.Sprintf("accounts[%d].name", i), Message: fmt.Sprintf("must be at most %d characters", maxAccountNameLength)})
+		case seen[strings.ToLower(name)]:
+			details = append(details, FieldError{Field: fmt.Sprintf("accounts[%d].name", i), Message: "is listed more than once"})
+		}
+		seen[strings.ToLower(name)] = true
+
+		if math.IsNaN(account.Balance) || math.Abs(account.Balance) > maxAccountBalance {
+			details = append(details, FieldError{Field: fmt.Sprintf("accounts[%d].balance", i), Message: fmt.Sprintf("must be a number between -%g and %g", maxAccountBalance, maxAccountBalance)})
+		}
+	}
+	return details
+}
+
+type EmergencyFund struct {
+	Balance               float64 `json:"balance"`
+	BalanceSource         string  `json:"balance_source"` // accounts, net_savings
+	EssentialMonthlySpend float64 `json:"essential_monthly_spend"`
+	MonthlySpend          float64 `json:"monthly_spend"`
+	CoverageMonths        float64 `json:"coverage_months"` // balance over essential spending
+	RunwayMonths          float64 `json:"runway_months"`   // balance over all spending, with no income
+	TargetMonths          float64 `json:"target_months"`
+	TargetAmount          float64 `json:"target_amount"` // target months of essential spending
+	Shortfall             float64 `json:"shortfall"`
+	Status                string  `json:"status"` // funded, building, low, critical, no_spending
+}
+
+func getEmergencyTargetMonths() float64 {
+	if value := os.Getenv("EMERGENCY_FUND_TARGET_MONTHS"); value != "" {
+		if months, err := strconv.ParseFloat(value, 64); err == nil && months > 0 && months <= maxEmergencyTargetMonths {
+			return months
+		}
+	}
+	return defaultEmergencyTargetMonths
+}
+
+// Reads ?target_months=. Balances come from ?action=accounts; one sent in
+// the query is refused rather than ignored, so the client learns where it
+// belongs.
+func emergencyFundOptionsFromQuery(r *http.Request) (emergencyFundOptions, error) {
+	opts := emergencyFundOptions{TargetMonths: getEmergencyTargetMonths()}
+	query := r.URL.Query()
+
+	var details []FieldError
+	if _, ok := query["balance"]; ok {
+		details = append(details, FieldError{Field: "balance", Message: "is not accepted in the query; store balances with PUT ?action=accounts"})
+	}
+
+	if raw := query.Get("target_months"); raw != "" {
+		months, err := strconv.ParseFloat(raw, 64)
+		if err != nil || !(months > 0 && months <= maxEmergencyTargetMonths) {
+			details = append(details, FieldError{Field: "target_months", Message: fmt.Sprintf("must be greater than 0 and at most %d", maxEmergencyTargetMonths)})
+		} else {
+			opts.TargetMonths = months
+		}
+	}
+
+	if len(details) > 0 {
+		return opts, validationError(details)
+	}
+	return opts, nil
+}
+
+// Measures how many months the user's balance covers essential and total
+// spending. Spending is averaged over the recent window, or the whole
+// history when it is shorter, but at least a month.
+func calculateEmergencyFund(transactions []Transaction, netSavings float64, bucketOverrides map[string]string, opts emergencyFundOptions, now time.Time) EmergencyFund {
+	fund := EmergencyFund{Balance: netSavings, BalanceSource: "net_savings", TargetMonths: opts.TargetMonths}
+	if opts.Balance != nil {
+		fund.Balance, fund.BalanceSource = *opts.Balance, "accounts"
+	}
+	fund.Balance = roundMoney(fund.Balance)
+
+	today := startOfDay(now)
+	windowStart := today.AddDate(0, 0, -emergencySpendWindowDays)
+	earliest := today
+	for _, t := range transactions {
+		if day := startOfDay(t.Date); day.Before(earliest) {
+			earliest = day
+		}
+	}
+	if earliest.After(windowStart) {
+		windowStart = earliest
+	}
+	months := math.Max(today.Sub(windowStart).Hours()/24+1, averageDaysPerMonth) / averageDaysPerMonth
+
+	var essential, total float64
+	for _, t := range transactions {
+		day := startOfDay(t.Date)
+		if t.Type != "expense" || day.Before(windowStart) || day.After(today) {
+			continue
+		}
+		total += t.Amount
+		if bucketFor(t.Category, bucketOverrides) == bucketNeeds {
+			essential += t.Amount
+		}
+	}
+	fund.EssentialMonthlySpend = roundMoney(essential / months)
+	fund.MonthlySpend = roundMoney(total / months)
+	fund.TargetAmount = roundMoney(fund.EssentialMonthlySpend * fund.TargetMonths)
+	fund.Shortfall = roundMoney(math.Max(fund.TargetAmount-fund.Balance, 0))
+
+	if fund.EssentialMonthlySpend <= 0 {
+		fund.Status = emergencyNoSpending
+		return fund
+	}
+
+	// Months are rounded down, so a fund is never shown as covering more than
+	// it does
+	available := math.Max(fund.Balance, 0)
+	fund.CoverageMonths = math.Floor(available/fund.EssentialMonthlySpend*10) / 10
+	fund.RunwayMonths = math.Floor(available/fund.MonthlySpend*10) / 10
+	switch coverage := available / fund.EssentialMonthlySpend; {
+	case coverage >= fund.TargetMonths:
+		fund.Status = emergencyFunded
+	case coverage >= fund.TargetMonths/2:
+		fund.Status = emergencyBuilding
+	case coverage >= 1:
+		fund.Status = emergencyLow
+	default:
+		fund.Status = emergencyCritical
+	}
+	return fund
+}
+
+// Recommendations for an emergency fund short of its target
+func emergencyFundRecommendations(fund EmergencyFund) []string {
+	switch fund.Status {
+	case emergencyFunded, emergencyNoSpending:
+		return nil
+	case emergencyCritical:
+		return []string{fmt.Sprintf("🛟 Your savings would cover less than a month of essentials ($%.2f a month) - start an emergency fund", fund.EssentialMonthlySpend)}
+	}
+	return []string{fmt.Sprintf("🛟 Your emergency fund covers %.1f months of essentials - build it to %g months ($%.2f more)", fund.CoverageMonths, fund.TargetMonths, fund.Shortfall)}
+}
+
+// The authenticated user's account balances, which the emergency fund is
+// measured against:
+//
+//	GET    ?action=accounts    stored balances
+//	PUT    ?action=accounts    replace, {"accounts": [{"name": "Savings", "balance": 5200}]}
+//	DELETE ?action=accounts    forget them, falling back to net savings
+func handleAccountBalances(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, err := verifyAuth(r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var request struct {
+			Accounts []AccountBalance `json:"accounts"`
+		}
+		hasBody, decodeErr := decodeJSONBody(w, r, &request)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+		if details := validateAccountBalances(request.Accounts); len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+
+		doc := userAccountBalances{Accounts: make([]AccountBalance, 0, len(request.Accounts)), UpdatedAt: time.Now().UTC()}
+		for _, account := range request.Accounts {
+			doc.Accounts = append(doc.Accounts, AccountBalance{Name: strings.TrimSpace(account.Name), Balance: roundMoney(account.Balance)})
+		}
+		if err := documents.Save(accountBalancesNamespace, userID, doc); err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Account balance storage is unavailable", err))
+			return
+		}
+		userInsights.invalidate(userID)
+	case "DELETE":
+		if err := documents.Delete(accountBalancesNamespace, userID); err != nil {
+			writeError(w, requestID, wrapAPIError(CodeInternal, "Account balance storage is unavailable", err))
+			return
+		}
+		userInsights.invalidate(userID)
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	doc, err := loadAccountBalances(userID)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"data":        doc,
+		"computed_at": time.Now().Unix(),
+		"function":    "calculate-insights",
+		"runtime":     "Go",
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateAccountBalances(t *testing.T) {
+	tooMany := make([]AccountBalance, maxAccountBalances+1)
+
+	tests := []struct {
+		name     string
+		accounts []AccountBalance
+		fields   []string
+	}{
+		{"valid", []AccountBalance{{Name: "Savings", Balance: 5200}, {Name: "Credit card", Balance: -300}}, nil},
+		{"none", nil, nil},
+		{"missing name", []AccountBalance{{Name: " ", Balance: 10}}, []string{"accounts[0].name"}},
+		{"duplicate name", []AccountBalance{{Name: "Savings"}, {Name: "savings "}}, []string{"accounts[1].name"}},
+		{"balance out of range", []AccountBalance{{Name: "Savings", Balance: 2e12}}, []string{"accounts[0].balance"}},
+		{"not a number", []AccountBalance{{Name: "Savings", Balance: math.NaN()}}, []string{"accounts[0].balance"}},
+		{"too many", tooMany, []string{"accounts"}},
+	}
+
+	for _, tt := range tests {
+		var fields []string
+		for _, detail := range validateAccountBalances(tt.accounts) {
+			fields = append(fields, detail.Field)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: invalid fields = %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+}
+
+func TestEmergencyFundOptionsFromQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		months float64
+		fields []string
+	}{
+		{"", defaultEmergencyTargetMonths, nil},
+		{"target_months=3", 3, nil},
+		{"target_months=0", defaultEmergencyTargetMonths, []string{"target_months"}},
+		{"balance=5000", defaultEmergencyTargetMonths, []string{"balance"}},
+	}
+
+	for _, tt := range tests {
+		opts, err := emergencyFundOptionsFromQuery(httptest.NewRequest("GET", "/?"+tt.query, nil))
+
+		var fields []string
+		if apiErr, ok := err.(*APIError); ok {
+			for _, detail := range apiErr.Details {
+				fields = append(fields, detail.Field)
+			}
+		}
+		if !reflect.DeepEqual(fields, tt.fields) || opts.TargetMonths != tt.months || opts.Balance != nil {
+			t.Errorf("%q: target months %v, balance %v, invalid fields %v; want %v, nil, %v", tt.query, opts.TargetMonths, opts.Balance, fields, tt.months, tt.fields)
+		}
+	}
+}
+
+func TestCalculateEmergencyFund(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	var transactions []Transaction
+	for month := 0; month < 3; month++ {
+		day := now.AddDate(0, -month, -1)
+		transactions = append(transactions,
+			Transaction{Category: "Rent", Type: "expense", Amount: 1000, Date: day},
+			Transaction{Category: "Dining", Type: "expense", Amount: 200, Date: day},
+		)
+	}
+	balance := 2500.0
+
+	tests := []struct {
+		name   string
+		opts   emergencyFundOptions
+		source string
+		status string
+	}{
+		{"stored balances", emergencyFundOptions{Balance: &balance, TargetMonths: 6}, "accounts", emergencyLow},
+		{"net savings without them", emergencyFundOptions{TargetMonths: 6}, "net_savings", emergencyCritical},
+	}
+
+	for _, tt := range tests {
+		fund := calculateEmergencyFund(transactions, 400, nil, tt.opts, now)
+		if fund.BalanceSource != tt.source || fund.Status != tt.status {
+			t.Errorf("%s: balance source, status = %s, %s; want %s, %s", tt.name, fund.BalanceSource, fund.Status, tt.source, tt.status)
+		}
+	}
+}
+
+func TestHandleAccountBalances(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response AuthServiceResponse
+		response.Success = true
+		response.User.ID = "accounts-test-user"
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer auth.Close()
+	t.Setenv("AUTH_SERVICE_URL", auth.URL)
+
+	serve := func(method, body string) (int, userAccountBalances) {
+		r := httptest.NewRequest(method, "/?action=accounts", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer accounts-test-token")
+		w := httptest.NewRecorder()
+		CalculateInsightsHandler(w, r)
+
+		var response struct {
+			Data userAccountBalances `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	if status, _ := serve("PUT", `{"accounts":[{"name":"Savings","balance":5200.004},{"name":"Checking","balance":-120}]}`); status != http.StatusOK {
+		t.Fatalf("PUT status %d, want 200", status)
+	}
+	status, doc := serve("GET", "")
+	if want := []AccountBalance{{Name: "Savings", Balance: 5200}, {Name: "Checking", Balance: -120}}; status != http.StatusOK || !reflect.DeepEqual(doc.Accounts, want) {
+		t.Errorf("GET = %d, %+v; want 200, %+v", status, doc.Accounts, want)
+	}
+	if total := doc.total(); total == nil || *total != 5080 {
+		t.Errorf("total = %v, want 5080", total)
+	}
+
+	if status, _ := serve("PUT", `{"accounts":[{"name":"","balance":1}]}`); status != http.StatusBadRequest {
+		t.Errorf("invalid PUT status %d, want 400", status)
+	}
+	if status, doc := serve("DELETE", ""); status != http.StatusOK || len(doc.Accounts) != 0 || doc.total() != nil {
+		t.Errorf("DELETE = %d, %+v; want 200 and no accounts", status, doc.Accounts)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
@@ -47,6 +48,10 @@ type Insight struct {
 	MonthlyExpenses      float64            `json:"monthly_expenses"`
 	SavingsRate          float64            `json:"savings_rate"`
 	SpendingByCategory   map[string]float64 `json:"spending_by_category"`
+	CategoryTree         []CategoryNode     `json:"category_tree"` // spending rolled up every level of the hierarchy
+	BucketBreakdown      BucketBreakdown    `json:"bucket_breakdown"`
+	Goals                []GoalProgress     `json:"goals"`
+	EmergencyFund        EmergencyFund      `json:"emergency_fund"`
 	FinancialHealthScore float64            `json:"financial_health_score"`
 	TrendAnalysis        TrendData          `json:"trend_analysis"`
 	Recommendations      []string           `json:"recommendations"`
@@ -68,16 +73,36 @@ func getTransactionAPIURL() string {
 	return os.Getenv("TRANSACTION_API_URL")
 }
 
-// Verify user authentication through auth-service
+// Verify user authentication, reusing a recent auth-service answer for the same token
 func verifyAuth(authHeader string) (string, error) {
 	if authHeader == "" {
-		return "", fmt.Errorf("authorization header required")
+		return "", newAPIError(CodeAuthMissing, "Authorization header required")
+	}
+
+	key := hashToken(authHeader)
+	if entry, ok := verifiedTokens.get(key); ok {
+		return entry.userID, entry.err
+	}
+
+	now := time.Now()
+	userID, err := verifyAuthRemote(authHeader)
+
+	var rejected *authRejectedError
+	if err == nil {
+		verifiedTokens.put(key, authCacheEntry{userID: userID, expiresAt: verifiedExpiry(authHeader, now)})
+	} else if errors.As(err, &rejected) {
+		verifiedTokens.put(key, authCacheEntry{err: err, expiresAt: now.Add(getAuthCacheNegativeTTL())})
 	}
 
+	return userID, err
+}
+
+// Verify user authentication through auth-service
+func verifyAuthRemote(authHeader string) (string, error) {
 	client := &http.Client{Timeout: 10 * time.Second}
 	req, err := http.NewRequest("GET", getAuthServiceURL()+"?action=verify", nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create auth request: %v", err)
+		return "", wrapAPIError(CodeInternal, "Internal error", fmt.Errorf("failed to create auth request: %w", err))
 	}
 
 	req.Header.Set("Authorization", authHeader)
@@ -85,17 +110,26 @@ func verifyAuth(authHeader string) (string, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("auth service call failed: %v", err)
+		return "", upstreamCallError(CodeAuthUnavailable, "Authentication service is unavailable", err)
 	}
 	defer resp.Body.Close()
 
+	// Only a 401/403, or a 200 that says the token isn't valid, is a
+	// rejection; anything else is auth-service failing and mustn't lock the
+	// user out
 	var authResp AuthServiceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
-		return "", fmt.Errorf("failed to decode auth response: %v", err)
-	}
-
-	if !authResp.Success {
-		return "", fmt.Errorf("authentication failed: %s", authResp.Error)
+	decodeErr := json.NewDecoder(resp.Body).Decode(&authResp)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return "", wrapAPIError(CodeAuthInvalid, "Invalid or expired token", &authRejectedError{reason: authResp.Error})
+	case resp.StatusCode != http.StatusOK:
+		return "", wrapAPIError(CodeAuthUnavailable, "Authentication service is unavailable", fmt.Errorf("auth service returned status %d", resp.StatusCode))
+	case decodeErr != nil:
+		return "", wrapAPIError(CodeAuthUnavailable, "Authentication service is unavailable", fmt.Errorf("failed to decode auth response: %w", decodeErr))
+	case !authResp.Success:
+		return "", wrapAPIError(CodeAuthInvalid, "Invalid or expired token", &authRejectedError{reason: authResp.Error})
+	case authResp.User.ID == "":
+		return "", wrapAPIError(CodeAuthUnavailable, "Authentication service is unavailable", errors.New("auth response has no user id"))
 	}
 
 	return authResp.User.ID, nil
@@ -106,7 +140,7 @@ func fetchTransactions(authHeader string) ([]Transaction, error) {
 	client := &http.Client{Timeout: 15 * time.Second}
 	req, err := http.NewRequest("GET", getTransactionAPIURL(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create transaction request: %v", err)
+		return nil, wrapAPIError(CodeInternal, "Internal error", fmt.Errorf("failed to create transaction request: %w", err))
 	}
 
 	req.Header.Set("Authorization", authHeader)
@@ -114,24 +148,28 @@ func fetchTransactions(authHeader string) ([]Transaction, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("transaction API call failed: %v", err)
+		return nil, upstreamCallError(CodeUpstreamUnavailable, "Transaction service is unavailable", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, newAPIError(CodeAuthInvalid, "Invalid or expired token")
+	}
+
 	var transResp TransactionAPIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&transResp); err != nil {
-		return nil, fmt.Errorf("failed to decode transaction response: %v", err)
+		return nil, wrapAPIError(CodeUpstreamBadResponse, "Transaction service returned an invalid response", fmt.Errorf("failed to decode transaction response: %w", err))
 	}
 
 	if !transResp.Success {
-		return nil, fmt.Errorf("transaction fetch failed: %s", transResp.Error)
+		return nil, wrapAPIError(CodeUpstreamBadResponse, "Transaction service returned an invalid response", fmt.Errorf("transaction fetch failed: %s", transResp.Error))
 	}
 
 	return transResp.Data, nil
 }
 
 // High-performance financial calculations
-func calculateInsights(transactions []Transaction) Insight {
+func calculateInsights(transactions []Transaction, bucketOverrides map[string]string, goals []SavingsGoal, fundOpts emergencyFundOptions, now time.Time) Insight {
 	var totalIncome, totalExpenses float64
 	spendingByCategory := make(map[string]float64)
 
@@ -151,14 +189,23 @@ func calculateInsights(transactions []Transaction) Insight {
 		savingsRate = ((totalIncome - totalExpenses) / totalIncome) * 100
 	}
 
+	// Classify spending into needs, wants and savings
+	buckets := calculateBucketBreakdown(spendingByCategory, totalIncome, totalExpenses, bucketOverrides)
+
+	// How long savings would last without income
+	emergencyFund := calculateEmergencyFund(transactions, netWorth, bucketOverrides, fundOpts, now)
+
 	// Calculate financial health score (0-100)
-	healthScore := calculateHealthScore(savingsRate, totalIncome, totalExpenses)
+	healthScore := calculateHealthScore(savingsRate, totalIncome, totalExpenses, emergencyFund)
 
 	// Generate trend analysis
 	trends := calculateTrends(transactions)
 
+	// Progress towards the user's savings goals
+	goalProgress := calculateGoalsProgress(goals, transactions, now)
+
 	// Generate AI-powered recommendations
-	recommendations := generateRecommendations(savingsRate, spendingByCategory, totalIncome)
+	recommendations := generateRecommendations(savingsRate, spendingByCategory, totalIncome, buckets, goalProgress, emergencyFund)
 
 	return Insight{
 		NetWorth:             netWorth,
@@ -166,13 +213,17 @@ func calculateInsights(transactions []Transaction) Insight {
 		MonthlyExpenses:      totalExpenses,
 		SavingsRate:          savingsRate,
 		SpendingByCategory:   spendingByCategory,
+		CategoryTree:         buildCategoryTree(spendingByCategory),
+		BucketBreakdown:      buckets,
+		Goals:                goalProgress,
+		EmergencyFund:        emergencyFund,
 		FinancialHealthScore: healthScore,
 		TrendAnalysis:        trends,
 		Recommendations:      recommendations,
 	}
 }
 
-func calculateHealthScore(savingsRate, income, expenses float64) float64 {
+func calculateHealthScore(savingsRate, income, expenses float64, fund EmergencyFund) float64 {
 	score := 50.0 // Base score
 
 	// Special case: if no transactions exist (no income, no expenses), return neutral score
@@ -214,6 +265,28 @@ func calculateHealthScore(savingsRate, income, expenses float64) float64 {
 		}
 	}
 
+	// Emergency fund factor: months of essential spending covered
+	switch fund.Status {
+	case emergencyFunded:
+		score += 10
+	case emergencyBuilding:
+		score += 5
+	case emergencyLow:
+		score -= 5
+	case emergencyCritical:
+		score -= 15
+	}
+
+	// Cash runway factor: months all spending could continue without income.
+	// Runway never exceeds coverage, so a critical fund is already penalized;
+	// it only counts when essentials are covered but everything else isn't.
+	switch fund.Status {
+	case emergencyFunded, emergencyBuilding, emergencyLow:
+		if fund.RunwayMonths < 1 {
+			score -= 5
+		}
+	}
+
 	// Ensure score is between 0 and 100
 	if score > 100 {
 		score = 100
@@ -259,10 +332,12 @@ func calculateTrends(transactions []Transaction) TrendData {
 	}
 }
 
-func generateRecommendations(savingsRate float64, spending map[string]float64, income float64) []string {
+func generateRecommendations(savingsRate float64, spending map[string]float64, income float64, buckets BucketBreakdown, goals []GoalProgress, fund EmergencyFund) []string {
 	var recommendations []string
 
-	if savingsRate < 10 {
+	// Goals say how much to save; without any, fall back to a rule of thumb
+	recommendations = append(recommendations, goalRecommendations(goals)...)
+	if savingsRate < 10 && len(goals) == 0 {
 		recommendations = append(recommendations, "💡 Aim to save at least 10% of your income")
 	}
 
@@ -270,6 +345,8 @@ func generateRecommendations(savingsRate float64, spending map[string]float64, i
 		recommendations = append(recommendations, "⚠️ You're spending more than you earn - consider cutting expenses")
 	}
 
+	recommendations = append(recommendations, emergencyFundRecommendations(fund)...)
+
 	// Find highest spending category
 	var maxCategory string
 	var maxAmount float64
@@ -286,6 +363,17 @@ func generateRecommendations(savingsRate float64, spending map[string]float64, i
 		recommendations = append(recommendations, fmt.Sprintf("🎯 Consider reducing %s expenses - you need income to balance spending", maxCategory))
 	}
 
+	// Compare needs/wants/savings against the 50/30/20 guideline
+	if buckets.Needs.Status == "above_guideline" {
+		recommendations = append(recommendations, fmt.Sprintf("🏠 Needs take %.1f%% of income - the 50/30/20 guideline suggests about 50%%", buckets.Needs.ShareOfIncome))
+	}
+	if buckets.Wants.Status == "above_guideline" {
+		recommendations = append(recommendations, fmt.Sprintf("🛍️ Wants take %.1f%% of income - try to keep them near 30%%", buckets.Wants.ShareOfIncome))
+	}
+	if buckets.Savings.Status == "below_guideline" && savingsRate >= 10 {
+		recommendations = append(recommendations, fmt.Sprintf("💰 Savings and debt repayment are %.1f%% of income - aim for 20%%", buckets.Savings.ShareOfIncome))
+	}
+
 	if savingsRate > 20 {
 		recommendations = append(recommendations, "🌟 Great job! You're saving over 20% - consider investing")
 	}
@@ -304,26 +392,53 @@ func generateRecommendations(savingsRate float64, spending map[string]float64, i
 // High-performance endpoint handler
 func CalculateInsightsHandler(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
+	requestID := requestIDFor(r)
 
 	// Enable CORS
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match, X-Request-ID")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Request-ID", requestID)
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	if r.Method == "POST" && r.URL.Query().Get("action") == "invalidate" {
+		handleInvalidate(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "bucket-mapping" {
+		handleBucketMapping(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "goals" {
+		handleSavingsGoals(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "debt-plan" {
+		handleDebtPlan(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "amortization" {
+		handleAmortization(w, r, requestID)
+		return
+	}
+
+	if r.URL.Query().Get("action") == "accounts" {
+		handleAccountBalances(w, r, requestID)
+		return
+	}
+
 	if r.Method != "GET" {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success":  false,
-			"error":    "Method not allowed",
-			"function": "calculate-insights",
-			"runtime":  "Go",
-		})
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
 		return
 	}
 
@@ -331,31 +446,79 @@ func CalculateInsightsHandler(w http.ResponseWriter, r *http.Request) {
 	authHeader := r.Header.Get("Authorization")
 	userID, err := verifyAuth(authHeader)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success":  false,
-			"error":    fmt.Sprintf("Authentication failed: %s", err.Error()),
-			"function": "calculate-insights",
-			"runtime":  "Go",
-		})
+		writeError(w, requestID, err)
+		return
+	}
+
+	fundOpts, err := emergencyFundOptionsFromQuery(r)
+	if err != nil {
+		writeError(w, requestID, err)
 		return
 	}
 
 	// Fetch transactions from transaction-api
 	transactions, err := fetchTransactions(authHeader)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success":  false,
-			"error":    fmt.Sprintf("Failed to fetch transactions: %s", err.Error()),
-			"function": "calculate-insights",
-			"runtime":  "Go",
-		})
+		// Stale-while-error: keep the dashboard populated with the last good result
+		if isUpstreamFailure(err) {
+			if lastGood, ok := loadLastGood(userID); ok {
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"success":            true,
+					"data":               lastGood.Insight,
+					"user_id":            userID,
+					"transactions_count": lastGood.TransactionsCount,
+					"computed_at":        lastGood.ComputedAt.Unix(),
+					"stale":              true,
+					"stale_age_seconds":  int64(time.Since(lastGood.ComputedAt).Seconds()),
+					"function":           "calculate-insights",
+					"runtime":            "Go",
+				})
+				return
+			}
+		}
+
+		writeError(w, requestID, err)
+		return
+	}
+
+	bucketOverrides, err := loadBucketOverrides(userID)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	goals, err := loadSavingsGoals(userID)
+	if err != nil {
+		writeError(w, requestID, err)
 		return
 	}
+	accounts, err := loadAccountBalances(userID)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+	fundOpts.Balance = accounts.total()
+	now := time.Now()
 
-	// Calculate insights using real data
-	insights := calculateInsights(transactions)
+	// Conditional request: nothing to send if the client already has this version
+	etag := insightETag(transactions, bucketOverrides, goals, fundOpts, now)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Calculate insights using real data, reusing the cached result while the data is unchanged
+	cached, hit := userInsights.get(userID)
+	hit = hit && cached.etag == etag
+	insights := cached.insight
+	if !hit {
+		insights = calculateInsights(transactions, bucketOverrides, goals, fundOpts, now)
+		computedAt := time.Now()
+		userInsights.put(userID, cachedInsight{etag: etag, insight: insights, computedAt: computedAt})
+		saveLastGood(userID, LastGoodInsight{Insight: insights, TransactionsCount: len(transactions), ComputedAt: computedAt})
+	}
 
 	processingTime := time.Since(startTime).Milliseconds()
 
@@ -367,7 +530,29 @@ func CalculateInsightsHandler(w http.ResponseWriter, r *http.Request) {
 		"transactions_count": len(transactions),
 		"computed_at":        time.Now().Unix(),
 		"processing_time_ms": processingTime,
+		"cached":             hit,
+		"stale":              false,
 		"function":           "calculate-insights",
 		"runtime":            "Go",
 	})
 }
+
+// Drop the caller's cached insight, e.g. after transaction-api writes
+func handleInvalidate(w http.ResponseWriter, r *http.Request, requestID string) {
+	userID, err := verifyAuth(r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	userInsights.invalidate(userID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"invalidated": true,
+		"user_id":     userID,
+		"function":    "calculate-insights",
+		"runtime":     "Go",
+	})
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Savings goals are funded by transactions linked to them by tag or
+// category. Money set aside is recorded as an expense, e.g. in a "Savings"
+// category, so a linked expense on or after the goal's start date is a
+// contribution; linked income is money taken back out of the goal.
+const savingsGoalsNamespace = "savings-goals"
+
+const (
+	maxSavingsGoals     = 20
+	maxGoalNameLength   = 100
+	maxGoalAmount       = 1e9
+	goalRateWindowDays  = 90    // recent contributions that set the savings rate
+	averageDaysPerMonth = 30.44 // 365.25 / 12
+)
+
+var (
+	errGoalNotFound = errors.New("savings goal not found")
+	errTooManyGoals = errors.New("savings goal limit reached")
+)
+
+// Serializes read-modify-write cycles on savings goals
+var savingsGoalsMu sync.Mutex
+
+type SavingsGoal struct {
+	ID            int     `json:"id"`
+	Name          string  `json:"name"`
+	TargetAmount  float64 `json:"target_amount"`
+	TargetDate    string  `json:"target_date"`              // YYYY-MM-DD
+	StartDate     string  `json:"start_date,omitempty"`     // YYYY-MM-DD, defaults to the day it was created
+	InitialAmount float64 `json:"initial_amount,omitempty"` // saved before the start date
+	Tag           string  `json:"tag,omitempty"`
+	Category      string  `json:"category,omitempty"` // includes subcategories
+}
+
+type GoalProgress struct {
+	SavingsGoal
+	Saved               float64 `json:"saved"`
+	Remaining           float64 `json:"remaining"`
+	PercentageComplete  float64 `json:"percentage_complete"`
+	ContributionCount   int     `json:"contribution_count"`
+	MonthlyRate         float64 `json:"monthly_rate"`                   // average net monthly contributions recently
+	RequiredMonthly     float64 `json:"required_monthly"`               // to finish by the target date
+	ProjectedCompletion string  `json:"projected_completion,omitempty"` // at the current rate; empty when it never completes
+	Status              string  `json:"status"`                         // completed, on_track, behind, overdue
+}
+
+// Stored form of one user's goals
+type userSavingsGoals struct {
+	NextID int           `json:"next_id"`
+	Goals  []SavingsGoal `json:"goals"`
+}
+
+// Reports whether a transaction contributes to the goal
+func (g SavingsGoal) linked(t Transaction) bool {
+	if g.Tag != "" {
+		for _, tag := range t.Tags {
+			if strings.EqualFold(strings.TrimSpace(tag), g.Tag) {
+				return true
+			}
+		}
+	}
+	return g.Category != "" && categoryWithin(categoryPath(t.Category), canonicalCategory(g.Category))
+}
+
+// The amount a linked transaction adds to the goal, negative when it takes
+// money out
+func goalMovement(t Transaction) float64 {
+	switch t.Type {
+	case "expense":
+		return t.Amount
+	case "income":
+		return -t.Amount
+	}
+	return 0
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Tracks a goal's contributions and projects when it will be reached at the
+// recent savings rate
+func calculateGoalProgress(goal SavingsGoal, transactions []Transaction, now time.Time) GoalProgress {
+	progress := GoalProgress{SavingsGoal: goal}
+	today := startOfDay(now)
+	start, _ := time.Parse("2006-01-02", goal.StartDate)
+	target, _ := time.Parse("2006-01-02", goal.TargetDate)
+
+	// Contributions over the recent window set the rate; a young goal's
+	// window is its whole life, but at least a month so one deposit doesn't
+	// look like a habit
+	rateStart := today.AddDate(0, 0, -goalRateWindowDays)
+	if start.After(rateStart) {
+		rateStart = start
+	}
+	rateDays := math.Max(today.Sub(rateStart).Hours()/24+1, averageDaysPerMonth)
+
+	saved := goal.InitialAmount
+	recent := 0.0
+	for _, t := range transactions {
+		day := startOfDay(t.Date)
+		if day.Before(start) || day.After(today) || !goal.linked(t) {
+			continue
+		}
+		amount := goalMovement(t)
+		saved += amount
+		if amount > 0 {
+			progress.ContributionCount++
+		}
+		if !day.Before(rateStart) {
+			recent += amount
+		}
+	}
+
+	remaining := math.Max(goal.TargetAmount-saved, 0)
+	progress.Saved = roundMoney(saved)
+	progress.Remaining = roundMoney(remaining)
+	progress.PercentageComplete = roundMoney(math.Max(saved, 0) / goal.TargetAmount * 100)
+	progress.MonthlyRate = roundMoney(recent / rateDays * averageDaysPerMonth)
+
+	if remaining == 0 {
+		progress.Status = "completed"
+		return progress
+	}
+
+	monthsLeft := target.Sub(today).Hours() / 24 / averageDaysPerMonth
+	if monthsLeft > 0 {
+		progress.RequiredMonthly = roundMoney(remaining / math.Max(monthsLeft, 1))
+	} else {
+		progress.RequiredMonthly = progress.Remaining // due now
+	}
+
+	var projected time.Time
+	if progress.MonthlyRate > 0 {
+		days := remaining / progress.MonthlyRate * averageDaysPerMonth
+		projected = today.AddDate(0, 0, int(math.Ceil(days)))
+		progress.ProjectedCompletion = projected.Format("2006-01-02")
+	}
+
+	switch {
+	case today.After(target):
+		progress.Status = "overdue"
+	case !projected.IsZero() && !projected.After(target):
+		progress.Status = "on_track"
+	default:
+		progress.Status = "behind"
+	}
+	return progress
+}
+
+func calculateGoalsProgress(goals []SavingsGoal, transactions []Transaction, now time.Time) []GoalProgress {
+	progress := make([]GoalProgress, 0, len(goals))
+	for _, goal := range goals {
+		progress = append(progress, calculateGoalProgress(goal, transactions, now))
+	}
+	return progress
+}
+
+func validateSavingsGoal(goal SavingsGoal) []FieldError {
+	var details []FieldError
+	switch name := strings.TrimSpace(goal.Name); {
+	case name == "":
+		details = append(details, FieldError{Field: "name", Message: "is required"})
+	case len(name) > maxGoalNameLength:
+		details = append(details, FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxGoalNameLength)})
+	}
+	if goal.TargetAmount <= 0 || goal.TargetAmount > maxGoalAmount {
+		details = append(details, FieldError{Field: "target_amount", Message: fmt.Sprintf("must be greater than 0 and at most %g", maxGoalAmount)})
+	}
+	if goal.InitialAmount < 0 || goal.InitialAmount > maxGoalAmount {
+		details = append(details, FieldError{Field: "initial_amount", Message: fmt.Sprintf("must be between 0 and %g", maxGoalAmount)})
+	}
+
+	target, targetErr := time.Parse("2006-01-02", goal.TargetDate)
+	if targetErr != nil {
+		details = append(details, FieldError{Field: "target_date", Message: "must be a date (YYYY-MM-DD)"})
+	}
+	if goal.StartDate != "" {
+		start, err := time.Parse("2006-01-02", goal.StartDate)
+		if err != nil {
+			details = append(details, FieldError{Field: "start_date", Message: "must be a date (YYYY-MM-DD)"})
+		} else if targetErr == nil && !start.Before(target) {
+			details = append(details, FieldError{Field: "target_date", Message: "must be after start_date"})
+		}
+	}
+
+	if strings.TrimSpace(goal.Tag) == "" && strings.TrimSpace(goal.Category) == "" {
+		details = append(details, FieldError{Field: "tag", Message: "tag or category is required to link contributions"})
+	}
+	if len(goal.Tag) > maxCategoryLength {
+		details = append(details, FieldError{Field: "tag", Message: fmt.Sprintf("must be at most %d characters", maxCategoryLength)})
+	}
+	if len(goal.Category) > maxCategoryLength {
+		details = append(details, FieldError{Field: "category", Message: fmt.Sprintf("must be at most %d characters", maxCategoryLength)})
+	}
+	return details
+}
+
+func loadSavingsGoals(userID string) ([]SavingsGoal, error) {
+	doc := userSavingsGoals{NextID: 1}
+	if _, err := documents.Load(savingsGoalsNamespace, userID, &doc); err != nil {
+		return nil, wrapAPIError(CodeInternal, "Savings goal storage is unavailable", err)
+	}
+	return doc.Goals, nil
+}
+
+// Read-modify-write of a user's goals
+func modifySavingsGoals(userID string, change func(doc *userSavingsGoals) error) error {
+	savingsGoalsMu.Lock()
+	defer savingsGoalsMu.Unlock()
+
+	doc := userSavingsGoals{NextID: 1}
+	if _, err := documents.Load(savingsGoalsNamespace, userID, &doc); err != nil {
+		return wrapAPIError(CodeInternal, "Savings goal storage is unavailable", err)
+	}
+	if err := change(&doc); err != nil {
+		return err
+	}
+	if err := documents.Save(savingsGoalsNamespace, userID, doc); err != nil {
+		return wrapAPIError(CodeInternal, "Savings goal storage is unavailable", err)
+	}
+	return nil
+}
+
+// Maps savings goal failures onto the error envelope
+func savingsGoalError(err error) error {
+	switch {
+	case errors.Is(err, errGoalNotFound):
+		return newAPIError(CodeNotFound, "Savings goal not found")
+	case errors.Is(err, errTooManyGoals):
+		return validationError([]FieldError{{Field: "goals", Message: fmt.Sprintf("must contain at most %d goals", maxSavingsGoals)}})
+	}
+	return err
+}
+
+// CRUD for the authenticated user's savings goals:
+//
+//	GET    ?action=goals         list, with progress
+//	GET    ?action=goals&id=N    one goal, with progress
+//	POST   ?action=goals         create, {"name": "Holiday", "target_amount": 2000, "target_date": "2027-06-01", "tag": "holiday"}
+//	PUT    ?action=goals&id=N    replace
+//	DELETE ?action=goals&id=N    delete
+func handleSavingsGoals(w http.ResponseWriter, r *http.Request, requestID string) {
+	authHeader := r.Header.Get("Authorization")
+	userID, err := verifyAuth(authHeader)
+	if err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	var id int
+	if rawID := r.URL.Query().Get("id"); rawID != "" || r.Method == "PUT" || r.Method == "DELETE" {
+		id, err = strconv.Atoi(rawID)
+		if err != nil || id <= 0 {
+			writeError(w, requestID, validationError([]FieldError{{Field: "id", Message: "must be a positive goal id"}}))
+			return
+		}
+	}
+
+	var result interface{}
+	status := http.StatusOK
+
+	switch r.Method {
+	case "GET":
+		goals, loadErr := loadSavingsGoals(userID)
+		if loadErr != nil {
+			writeError(w, requestID, loadErr)
+			return
+		}
+		if id > 0 {
+			var found []SavingsGoal
+			for _, goal := range goals {
+				if goal.ID == id {
+					found = append(found, goal)
+				}
+			}
+			if len(found) == 0 {
+				writeError(w, requestID, savingsGoalError(errGoalNotFound))
+				return
+			}
+			goals = found
+		}
+
+		transactions, fetchErr := fetchTransactions(authHeader)
+		if fetchErr != nil {
+			writeError(w, requestID, fetchErr)
+			return
+		}
+		progress := calculateGoalsProgress(goals, transactions, time.Now())
+		if id > 0 {
+			result = progress[0]
+		} else {
+			result = progress
+		}
+
+	case "POST", "PUT":
+		var goal SavingsGoal
+		hasBody, decodeErr := decodeJSONBody(w, r, &goal)
+		if decodeErr != nil {
+			writeError(w, requestID, decodeErr)
+			return
+		}
+		if !hasBody {
+			writeError(w, requestID, validationError([]FieldError{{Field: "body", Message: "is required"}}))
+			return
+		}
+		if details := validateSavingsGoal(goal); len(details) > 0 {
+			writeError(w, requestID, validationError(details))
+			return
+		}
+		goal.Name = strings.TrimSpace(goal.Name)
+		goal.Tag = strings.TrimSpace(goal.Tag)
+		goal.Category = canonicalCategory(goal.Category)
+		goal.InitialAmount = roundMoney(goal.InitialAmount)
+		goal.TargetAmount = roundMoney(goal.TargetAmount)
+
+		saveErr := modifySavingsGoals(userID, func(doc *userSavingsGoals) error {
+			if r.Method == "POST" {
+				if len(doc.Goals) >= maxSavingsGoals {
+					return errTooManyGoals
+				}
+				if goal.StartDate == "" {
+					goal.StartDate = time.Now().UTC().Format("2006-01-02")
+				}
+				goal.ID = doc.NextID
+				doc.NextID++
+				doc.Goals = append(doc.Goals, goal)
+				return nil
+			}
+			for i := range doc.Goals {
+				if doc.Goals[i].ID == id {
+					if goal.StartDate == "" {
+						goal.StartDate = doc.Goals[i].StartDate
+					}
+					goal.ID = id
+					doc.Goals[i] = goal
+					return nil
+				}
+			}
+			return errGoalNotFound
+		})
+		if saveErr != nil {
+			writeError(w, requestID, savingsGoalError(saveErr))
+			return
+		}
+		if r.Method == "POST" {
+			status = http.StatusCreated
+		}
+		result = goal
+
+	case "DELETE":
+		deleteErr := modifySavingsGoals(userID, func(doc *userSavingsGoals) error {
+			for i := range doc.Goals {
+				if doc.Goals[i].ID == id {
+					doc.Goals = append(doc.Goals[:i], doc.Goals[i+1:]...)
+					return nil
+				}
+			}
+			return errGoalNotFound
+		})
+		if deleteErr != nil {
+			writeError(w, requestID, savingsGoalError(deleteErr))
+			return
+		}
+		result = map[string]interface{}{"id": id, "deleted": true}
+
+	default:
+		writeError(w, requestID, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	// Goals are part of the insight, so any change invalidates it
+	if r.Method != "GET" {
+		userInsights.invalidate(userID)
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"data":        result,
+		"computed_at": time.Now().Unix(),
+		"function":    "calculate-insights",
+		"runtime":     "Go",
+	})
+}
+
+// Recommendations for goals that need attention, most urgent first
+func goalRecommendations(goals []GoalProgress) []string {
+	pending := make([]GoalProgress, 0, len(goals))
+	for _, goal := range goals {
+		if goal.Status == "behind" || goal.Status == "overdue" {
+			pending = append(pending, goal)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].TargetDate < pending[j].TargetDate })
+
+	var recommendations []string
+	for _, goal := range pending {
+		if goal.Status == "overdue" {
+			recommendations = append(recommendations, fmt.Sprintf("⏰ %s is past its target date with $%.2f to go", goal.Name, goal.Remaining))
+			continue
+		}
+		recommendations = append(recommendations, fmt.Sprintf("🎯 Save $%.2f a month to reach %s by %s (currently $%.2f)", goal.RequiredMonthly, goal.Name, goal.TargetDate, goal.MonthlyRate))
+	}
+	return recommendations
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var goalsNow = time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+func goalTransaction(date, kind string, amount float64, tags ...string) Transaction {
+	day, _ := time.Parse("2006-01-02", date)
+	return Transaction{Date: day, Type: kind, Amount: amount, Tags: tags}
+}
+
+func TestSavingsGoalLinked(t *testing.T) {
+	tests := []struct {
+		name        string
+		goal        SavingsGoal
+		transaction Transaction
+		want        bool
+	}{
+		{"tag ignores case and spaces", SavingsGoal{Tag: "holiday"}, Transaction{Tags: []string{" Holiday "}}, true},
+		{"other tag", SavingsGoal{Tag: "holiday"}, Transaction{Tags: []string{"car"}}, false},
+		{"category", SavingsGoal{Category: "Savings"}, Transaction{Category: "Savings"}, true},
+		{"subcategory", SavingsGoal{Category: "savings"}, Transaction{Category: "Savings > Holiday"}, true},
+		{"parent category", SavingsGoal{Category: "Savings > Holiday"}, Transaction{Category: "Savings"}, false},
+		{"untagged, uncategorized", SavingsGoal{Tag: "holiday"}, Transaction{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.goal.linked(tt.transaction); got != tt.want {
+			t.Errorf("%s: linked = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGoalMovement(t *testing.T) {
+	tests := []struct {
+		kind string
+		want float64
+	}{
+		{"expense", 40},
+		{"income", -40},
+		{"transfer", 0},
+	}
+
+	for _, tt := range tests {
+		if got := goalMovement(Transaction{Type: tt.kind, Amount: 40}); got != tt.want {
+			t.Errorf("goalMovement(%s) = %v, want %v", tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateGoalProgress(t *testing.T) {
+	holiday := SavingsGoal{Name: "Holiday", TargetAmount: 2000, StartDate: "2026-08-01", TargetDate: "2027-06-01", Tag: "holiday"}
+
+	tests := []struct {
+		name         string
+		goal         SavingsGoal
+		transactions []Transaction
+		want         GoalProgress
+	}{
+		{
+			name: "linked income is taken back out of the goal",
+			goal: holiday,
+			transactions: []Transaction{
+				goalTransaction("2026-07-15", "expense", 900, "holiday"), // before the start
+				goalTransaction("2026-08-05", "expense", 300, "holiday"),
+				goalTransaction("2026-09-05", "expense", 300, "holiday"),
+				goalTransaction("2026-09-20", "expense", 500), // not linked
+				goalTransaction("2026-10-01", "income", 100, "holiday"),
+				goalTransaction("2026-10-10", "income", 50, "holiday"),
+				goalTransaction("2026-10-25", "expense", 900, "holiday"), // in the future
+			},
+			want: GoalProgress{
+				Saved:               450,
+				Remaining:           1550,
+				PercentageComplete:  22.5,
+				ContributionCount:   2,
+				MonthlyRate:         173.39,
+				RequiredMonthly:     208.77,
+				ProjectedCompletion: "2027-07-18",
+				Status:              "behind",
+			},
+		},
+		{
+			name: "expenses in the savings category are contributions",
+			goal: SavingsGoal{Name: "Rainy day", TargetAmount: 3000, StartDate: "2026-08-01", TargetDate: "2027-06-01", Category: "Savings"},
+			transactions: []Transaction{
+				{Category: "Savings", Type: "expense", Amount: 250, Date: time.Date(2026, time.September, 1, 9, 0, 0, 0, time.UTC)},
+				{Category: "Savings > Emergency", Type: "expense", Amount: 250, Date: time.Date(2026, time.October, 1, 9, 0, 0, 0, time.UTC)},
+				{Category: "Groceries", Type: "expense", Amount: 80, Date: time.Date(2026, time.October, 2, 9, 0, 0, 0, time.UTC)},
+			},
+			want: GoalProgress{
+				Saved:               500,
+				Remaining:           2500,
+				PercentageComplete:  16.67,
+				ContributionCount:   2,
+				MonthlyRate:         192.66,
+				RequiredMonthly:     336.73,
+				ProjectedCompletion: "2027-11-17",
+				Status:              "behind",
+			},
+		},
+		{
+			name: "net withdrawals never project completion",
+			goal: holiday,
+			transactions: []Transaction{
+				goalTransaction("2026-08-05", "expense", 100, "holiday"),
+				goalTransaction("2026-09-05", "income", 300, "holiday"),
+			},
+			want: GoalProgress{
+				Saved:             -200,
+				Remaining:         2200,
+				ContributionCount: 1,
+				MonthlyRate:       -77.06,
+				RequiredMonthly:   296.32,
+				Status:            "behind",
+			},
+		},
+		{
+			name: "a young goal's rate is spread over at least a month",
+			goal: SavingsGoal{TargetAmount: 1000, StartDate: "2026-10-15", TargetDate: "2027-10-15", Tag: "holiday"},
+			transactions: []Transaction{
+				goalTransaction("2026-10-16", "expense", 100, "holiday"),
+			},
+			want: GoalProgress{
+				Saved:               100,
+				Remaining:           900,
+				PercentageComplete:  10,
+				ContributionCount:   1,
+				MonthlyRate:         100,
+				RequiredMonthly:     75.68,
+				ProjectedCompletion: "2027-07-19",
+				Status:              "on_track",
+			},
+		},
+		{
+			name: "the initial amount can complete a goal",
+			goal: SavingsGoal{TargetAmount: 500, InitialAmount: 500, StartDate: "2026-08-01", TargetDate: "2027-06-01", Tag: "holiday"},
+			want: GoalProgress{
+				Saved:              500,
+				PercentageComplete: 100,
+				Status:             "completed",
+			},
+		},
+		{
+			name: "past the target date",
+			goal: SavingsGoal{TargetAmount: 500, StartDate: "2026-01-01", TargetDate: "2026-09-01", Tag: "holiday"},
+			transactions: []Transaction{
+				goalTransaction("2026-08-05", "expense", 200, "holiday"),
+			},
+			want: GoalProgress{
+				Saved:               200,
+				Remaining:           300,
+				PercentageComplete:  40,
+				ContributionCount:   1,
+				MonthlyRate:         66.9,
+				RequiredMonthly:     300,
+				ProjectedCompletion: "2027-03-04",
+				Status:              "overdue",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateGoalProgress(tt.goal, tt.transactions, goalsNow)
+			tt.want.SavingsGoal = tt.goal
+			if got != tt.want {
+				t.Errorf("progress = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSavingsGoal(t *testing.T) {
+	valid := SavingsGoal{Name: "Holiday", TargetAmount: 2000, TargetDate: "2027-06-01", Tag: "holiday"}
+
+	tests := []struct {
+		name   string
+		change func(goal *SavingsGoal)
+		fields []string
+	}{
+		{"valid", func(goal *SavingsGoal) {}, nil},
+		{"missing name", func(goal *SavingsGoal) { goal.Name = " " }, []string{"name"}},
+		{"zero target", func(goal *SavingsGoal) { goal.TargetAmount = 0 }, []string{"target_amount"}},
+		{"negative initial amount", func(goal *SavingsGoal) { goal.InitialAmount = -1 }, []string{"initial_amount"}},
+		{"bad target date", func(goal *SavingsGoal) { goal.TargetDate = "June" }, []string{"target_date"}},
+		{"target before start", func(goal *SavingsGoal) { goal.StartDate = "2027-07-01" }, []string{"target_date"}},
+		{"nothing links contributions", func(goal *SavingsGoal) { goal.Tag = "" }, []string{"tag"}},
+	}
+
+	for _, tt := range tests {
+		goal := valid
+		tt.change(&goal)
+
+		var fields []string
+		for _, detail := range validateSavingsGoal(goal) {
+			fields = append(fields, detail.Field)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: invalid fields = %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+}
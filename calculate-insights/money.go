@@ -0,0 +1,18 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Rounds an amount to whole cents, the precision every money value (and
+// percentage) in a response uses
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Payment plans start with next month's payment
+func firstPaymentMonth(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+}
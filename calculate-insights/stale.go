@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const lastGoodNamespace = "last-good-insights"
+
+// LastGoodInsight is the most recent insight successfully computed for a
+// user, served with `stale: true` while transaction-api is unavailable
+type LastGoodInsight struct {
+	Insight           Insight   `json:"insight"`
+	TransactionsCount int       `json:"transactions_count"`
+	ComputedAt        time.Time `json:"computed_at"`
+}
+
+func saveLastGood(userID string, result LastGoodInsight) {
+	if err := documents.Save(lastGoodNamespace, userID, result); err != nil {
+		log.Printf("calculate-insights: failed to persist last good insight: %v", err)
+	}
+}
+
+func loadLastGood(userID string) (LastGoodInsight, bool) {
+	var result LastGoodInsight
+	found, err := documents.Load(lastGoodNamespace, userID, &result)
+	if err != nil {
+		log.Printf("calculate-insights: failed to load last good insight: %v", err)
+		return LastGoodInsight{}, false
+	}
+	return result, found
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// DocumentStore persists JSON documents addressed by namespace and key.
+// Implementations must be safe for concurrent use.
+type DocumentStore interface {
+	// Load decodes the document into v, reporting false when it doesn't exist
+	Load(namespace, key string, v interface{}) (bool, error)
+	Save(namespace, key string, v interface{}) error
+	Delete(namespace, key string) error
+}
+
+// MemoryDocumentStore keeps documents for the lifetime of the function instance
+type MemoryDocumentStore struct {
+	mu   sync.RWMutex
+	docs map[string][]byte
+}
+
+func NewMemoryDocumentStore() *MemoryDocumentStore {
+	return &MemoryDocumentStore{docs: make(map[string][]byte)}
+}
+
+func (s *MemoryDocumentStore) Load(namespace, key string, v interface{}) (bool, error) {
+	s.mu.RLock()
+	data, ok := s.docs[namespace+"/"+key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func (s *MemoryDocumentStore) Save(namespace, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode document: %v", err)
+	}
+
+	s.mu.Lock()
+	s.docs[namespace+"/"+key] = data
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryDocumentStore) Delete(namespace, key string) error {
+	s.mu.Lock()
+	delete(s.docs, namespace+"/"+key)
+	s.mu.Unlock()
+	return nil
+}
+
+// FileDocumentStore writes one JSON file per document under a base directory,
+// so documents survive instance restarts when the directory is on a volume
+type FileDocumentStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileDocumentStore(dir string) *FileDocumentStore {
+	return &FileDocumentStore{dir: dir}
+}
+
+var safeKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func (s *FileDocumentStore) path(namespace, key string) string {
+	if !safeKeyPattern.MatchString(key) {
+		sum := sha256.Sum256([]byte(key))
+		key = hex.EncodeToString(sum[:])
+	}
+	return filepath.Join(s.dir, namespace, key+".json")
+}
+
+func (s *FileDocumentStore) Load(namespace, key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	data, err := os.ReadFile(s.path(namespace, key))
+	s.mu.Unlock()
+
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read document: %v", err)
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func (s *FileDocumentStore) Save(namespace, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode document: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.path(namespace, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create store directory: %v", err)
+	}
+
+	// Write-then-rename so readers never see a partially written document
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write document: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to commit document: %v", err)
+	}
+	return nil
+}
+
+func (s *FileDocumentStore) Delete(namespace, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(namespace, key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete document: %v", err)
+	}
+	return nil
+}
+
+// Store backend selection: STORE_BACKEND=memory (default) or file, with
+// STORE_DIR as the file backend's base directory
+func newDocumentStore() DocumentStore {
+	if os.Getenv("STORE_BACKEND") == "file" {
+		dir := os.Getenv("STORE_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "calculate-insights")
+		}
+		return NewFileDocumentStore(dir)
+	}
+	return NewMemoryDocumentStore()
+}
+
+var documents = newDocumentStore()
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Limits on request bodies
+const (
+	maxRequestBodyBytes = 64 << 10 // 64 KiB
+	maxBucketMappings   = 100
+	maxCategoryLength   = 100
+)
+
+func validationError(details []FieldError) *APIError {
+	err := newAPIError(CodeValidationFailed, "Request validation failed")
+	err.Details = details
+	return err
+}
+
+// decodeJSONBody strictly decodes a single JSON object from the request body:
+// unknown fields, trailing data and oversized bodies are rejected. An empty
+// body reports false without error so callers can decide whether it's allowed.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) (bool, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, validationError([]FieldError{decodeFieldError(err)})
+	}
+
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return false, validationError([]FieldError{{Field: "body", Message: "must contain a single JSON object"}})
+	}
+
+	return true, nil
+}
+
+// Translates a json decoding failure into the field it concerns
+func decodeFieldError(err error) FieldError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &sizeErr):
+		return FieldError{Field: "body", Message: fmt.Sprintf("must not exceed %d bytes", sizeErr.Limit)}
+	case errors.As(err, &syntaxErr):
+		return FieldError{Field: "body", Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		return FieldError{Field: typeErr.Field, Message: "has the wrong type (got " + typeErr.Value + ")"}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return FieldError{Field: strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`), Message: "is not a recognized field"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return FieldError{Field: "body", Message: "malformed JSON: unexpected end of input"}
+	}
+	return FieldError{Field: "body", Message: "must be a valid JSON object"}
+}
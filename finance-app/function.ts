@@ -1597,7 +1597,7 @@ export default {
                     updateInsightsView();
                     updateDashboardStats();
                 } else {
-                    throw new Error(result.error || 'Failed to fetch insights');
+                    throw new Error((result.error && result.error.message) || 'Failed to fetch insights');
                 }
             } catch (error) {
                 console.error('Error fetching insights:', error);
@@ -1984,7 +1984,7 @@ export default {
                             <div style="display: flex; flex-direction: column; gap: 0.75rem;">
                                 \${alerts.map(alert => \`
                                     <div style="padding: 0.75rem; background: #fef2f2; border-radius: 6px; border-left: 4px solid #dc2626;">
-                                        <p style="margin: 0; color: #1e293b; font-size: 0.875rem;">⚠️ \${alert}</p>
+                                        <p style="margin: 0; color: #1e293b; font-size: 0.875rem;">⚠️ \${alert.message || alert}</p>
                                     </div>
                                 \`).join('')}
                             </div>
@@ -2012,7 +2012,7 @@ export default {
                                     <div style="padding: 1rem; background: #f8fafc; border-radius: 8px; border: 1px solid #e2e8f0;">
                                         <div style="display: flex; justify-content: space-between; align-items: center; margin-bottom: 0.5rem;">
                                             <strong style="color: #1e293b; text-transform: capitalize;">\${category.category}</strong>
-                                            <span style="color: \${category.status === 'over_budget' ? '#dc2626' : category.status === 'warning' ? '#eab308' : '#16a34a'}; font-weight: 600; text-transform: capitalize;">\${category.status.replace('_', ' ')}</span>
+                                            <span style="color: \${category.status === 'over_budget' || category.status === 'critical' ? '#dc2626' : category.status === 'warning' ? '#eab308' : '#16a34a'}; font-weight: 600; text-transform: capitalize;">\${category.status.replace('_', ' ')}</span>
                                         </div>
                                         <p style="margin: 0.5rem 0; color: #64748b; font-size: 0.875rem;">\${category.recommendation}</p>
                                         <div style="display: grid; grid-template-columns: repeat(auto-fit, minmax(120px, 1fr)); gap: 0.5rem; font-size: 0.875rem;">